@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+)
+
+import (
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+type recordsOptions struct {
+	domainName   string
+	apiKeyFile   string
+	apiKeySecret string
+	output       string
+}
+
+func (o *recordsOptions) api() (namesilo_api.NamesiloApi, error) {
+	return GetNamesiloApi(o.domainName, o.apiKeyFile, o.apiKeySecret)
+}
+
+func recordsCommand() *cobra.Command {
+	opts := recordsOptions{}
+
+	recordsCmd := &cobra.Command{
+		Use:   "records",
+		Short: "inspect and repair records in the Namesilo zone",
+	}
+
+	recordsCmd.PersistentFlags().StringVarP(&opts.domainName, "domain", "d", "", "domain name for API calls")
+	recordsCmd.PersistentFlags().StringVarP(&opts.output, "output", "o", "table", "output format; one of table, json, yaml")
+	recordsCmd.PersistentFlags().StringVar(&opts.apiKeyFile, "api-key-file", "", "file containing the Namesilo API key")
+	recordsCmd.PersistentFlags().StringVar(&opts.apiKeySecret, "api-key-secret", "", "secret containing the Namesilo API key, as namespace/name:key")
+
+	recordsCmd.AddCommand(recordsListCommand(&opts))
+	recordsCmd.AddCommand(recordsGetCommand(&opts))
+	recordsCmd.AddCommand(recordsAddCommand(&opts))
+	recordsCmd.AddCommand(recordsUpdateCommand(&opts))
+	recordsCmd.AddCommand(recordsDeleteCommand(&opts))
+
+	return recordsCmd
+}
+
+func recordsListCommand(opts *recordsOptions) *cobra.Command {
+	var recordType string
+	var hostPattern string
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list records, optionally filtered by type and host",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := opts.api()
+			if err != nil {
+				return err
+			}
+
+			records, err := api.ListDNSRecords()
+			if err != nil {
+				return err
+			}
+
+			records, err = filterRecords(records, recordType, hostPattern)
+			if err != nil {
+				return err
+			}
+
+			return writeRecords(cmd.OutOrStdout(), opts.output, records)
+		},
+	}
+
+	listCmd.Flags().StringVarP(&recordType, "type", "t", "", "only list records of this type")
+	listCmd.Flags().StringVar(&hostPattern, "host", "", "only list records with hosts matching this glob, like *.example.com")
+
+	return listCmd
+}
+
+func recordsGetCommand(opts *recordsOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <record-id>",
+		Short: "show a single record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := opts.api()
+			if err != nil {
+				return err
+			}
+
+			rr, err := findRecord(api, args[0])
+			if err != nil {
+				return err
+			}
+
+			return writeRecords(cmd.OutOrStdout(), opts.output, []namesilo_api.ResourceRecord{*rr})
+		},
+	}
+}
+
+func recordsAddCommand(opts *recordsOptions) *cobra.Command {
+	var recordType string
+	var rr namesilo_api.ResourceRecord
+	var yes bool
+
+	addCmd := &cobra.Command{
+		Use:   "add",
+		Short: "add a record",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			rr.Type, err = namesilo_api.ParseRecordType(recordType)
+			if err != nil {
+				return err
+			}
+
+			api, err := opts.api()
+			if err != nil {
+				return err
+			}
+
+			if !confirm(cmd, yes, fmt.Sprintf("Add %s?", describeRecord(rr))) {
+				return nil
+			}
+
+			return api.AddDNSRecord(rr)
+		},
+	}
+
+	addCmd.Flags().StringVarP(&recordType, "type", "t", "", "record type")
+	addCmd.Flags().StringVar(&rr.Host, "host", "", "record host, either relative to the domain or fully qualified")
+	addCmd.Flags().StringVar(&rr.Value, "value", "", "record value")
+	addCmd.Flags().IntVar(&rr.TTL, "ttl", namesilo_api.DefaultTTL, "record ttl")
+	addCmd.Flags().IntVar(&rr.Distance, "distance", 0, "priority of MX and SRV records")
+	addCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+	addCmd.MarkFlagRequired("type")
+	addCmd.MarkFlagRequired("value")
+
+	return addCmd
+}
+
+func recordsUpdateCommand(opts *recordsOptions) *cobra.Command {
+	var recordType string
+	var host string
+	var value string
+	var ttl int
+	var distance int
+	var yes bool
+
+	updateCmd := &cobra.Command{
+		Use:   "update <record-id>",
+		Short: "change some or all of the fields of a record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := opts.api()
+			if err != nil {
+				return err
+			}
+
+			existing, err := findRecord(api, args[0])
+			if err != nil {
+				return err
+			}
+
+			rr := *existing
+			if cmd.Flags().Changed("type") {
+				if err := checkTypeUnchanged(*existing, recordType); err != nil {
+					return err
+				}
+			}
+			if cmd.Flags().Changed("host") {
+				rr.Host = host
+			}
+			if cmd.Flags().Changed("value") {
+				rr.Value = value
+			}
+			if cmd.Flags().Changed("ttl") {
+				rr.TTL = ttl
+			}
+			if cmd.Flags().Changed("distance") {
+				rr.Distance = distance
+			}
+
+			if rr.EqualsRecord(*existing) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Record already up to date.")
+				return nil
+			}
+
+			if !confirm(cmd, yes, fmt.Sprintf("Change %s to %s?", describeRecord(*existing), describeRecord(rr))) {
+				return nil
+			}
+
+			return api.UpdateDNSRecord(rr)
+		},
+	}
+
+	updateCmd.Flags().StringVarP(&recordType, "type", "t", "", "record type, which must be the record's current type")
+	updateCmd.Flags().StringVar(&host, "host", "", "record host, either relative to the domain or fully qualified")
+	updateCmd.Flags().StringVar(&value, "value", "", "record value")
+	updateCmd.Flags().IntVar(&ttl, "ttl", namesilo_api.DefaultTTL, "record ttl")
+	updateCmd.Flags().IntVar(&distance, "distance", 0, "priority of MX and SRV records")
+	updateCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+
+	return updateCmd
+}
+
+func recordsDeleteCommand(opts *recordsOptions) *cobra.Command {
+	var yes bool
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <record-id>",
+		Short: "delete a record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := opts.api()
+			if err != nil {
+				return err
+			}
+
+			rr, err := findRecord(api, args[0])
+			if err != nil {
+				return err
+			}
+
+			if !confirm(cmd, yes, fmt.Sprintf("Delete %s?", describeRecord(*rr))) {
+				return nil
+			}
+
+			return api.DeleteDNSRecord(*rr)
+		},
+	}
+
+	deleteCmd.Flags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+
+	return deleteCmd
+}
+
+// checkTypeUnchanged fails when recordType isn't the type of rr already,
+// since Namesilo can't change the type of a record.
+func checkTypeUnchanged(rr namesilo_api.ResourceRecord, recordType string) error {
+	rt, err := namesilo_api.ParseRecordType(recordType)
+	if err != nil {
+		return err
+	}
+
+	if rt != rr.Type {
+		return fmt.Errorf("can't change the type of record %s from %s to %s; delete it and add a new record instead", rr.RecordId, rr.Type, rt)
+	}
+
+	return nil
+}
+
+func findRecord(api namesilo_api.NamesiloApi, recordId string) (*namesilo_api.ResourceRecord, error) {
+	records, err := api.ListDNSRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rr := range records {
+		if rr.RecordId == recordId {
+			return &rr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find record with id %s", recordId)
+}
+
+// filterRecords keeps the records matching the given type, and whose host,
+// in either its punycode or Unicode form, matches the glob pattern.
+func filterRecords(records []namesilo_api.ResourceRecord, recordType, hostPattern string) ([]namesilo_api.ResourceRecord, error) {
+	var rt namesilo_api.RecordType
+	if recordType != "" {
+		var err error
+		if rt, err = namesilo_api.ParseRecordType(recordType); err != nil {
+			return nil, err
+		}
+	}
+
+	hostPattern = strings.ToLower(strings.TrimSuffix(hostPattern, "."))
+	if _, err := path.Match(hostPattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid host pattern %q: %s", hostPattern, err.Error())
+	}
+
+	rv := []namesilo_api.ResourceRecord{}
+	for _, rr := range records {
+		if rt != "" && rr.Type != rt {
+			continue
+		}
+
+		if hostPattern != "" {
+			matchesHost, _ := path.Match(hostPattern, rr.Host)
+			matchesDisplay, _ := path.Match(hostPattern, namesilo_api.DisplayHost(rr.Host))
+			if !matchesHost && !matchesDisplay {
+				continue
+			}
+		}
+
+		rv = append(rv, rr)
+	}
+
+	return rv, nil
+}
+
+func writeRecords(w io.Writer, format string, records []namesilo_api.ResourceRecord) error {
+	switch format {
+	case "json":
+		body, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(body))
+		return err
+	case "yaml":
+		body, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(body)
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTYPE\tHOST\tTTL\tDISTANCE\tVALUE")
+		for _, rr := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", rr.RecordId, rr.Type, namesilo_api.DisplayHost(rr.Host), rr.TTL, rr.Distance, rr.Value)
+		}
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", format)
+}
+
+func describeRecord(rr namesilo_api.ResourceRecord) string {
+	return fmt.Sprintf("%s record %s -> %s (ttl %d, distance %d)", rr.Type, namesilo_api.DisplayHost(rr.Host), rr.Value, rr.TTL, rr.Distance)
+}
+
+// confirm asks the user to approve a change, unless they already have with
+// --yes.
+func confirm(cmd *cobra.Command, yes bool, prompt string) bool {
+	if yes {
+		return true
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "y" || answer == "yes" {
+		return true
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), "Aborted.")
+	return false
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+var testRecords = []namesilo_api.ResourceRecord{
+	{RecordId: "1", Type: "A", Host: "example.com", Value: "1.1.1.1", TTL: 7207},
+	{RecordId: "2", Type: "CNAME", Host: "www.example.com", Value: "example.com", TTL: 7207},
+	{RecordId: "3", Type: "CNAME", Host: "xn--bcher-kva.example.com", Value: "example.com", TTL: 3600},
+	{RecordId: "4", Type: "MX", Host: "example.com", Value: "mail.example.com", TTL: 7207, Distance: 10},
+}
+
+func TestFilterRecords(t *testing.T) {
+	var tests = []struct {
+		name        string
+		recordType  string
+		hostPattern string
+		expected    []string
+		err         string
+	}{
+		{"All", "", "", []string{"1", "2", "3", "4"}, ""},
+		{"Type", "cname", "", []string{"2", "3"}, ""},
+		{"Host", "", "example.com", []string{"1", "4"}, ""},
+		{"Glob", "", "*.Example.com.", []string{"2", "3"}, ""},
+		{"TypeAndHost", "MX", "example.com", []string{"4"}, ""},
+		{"Punycode", "", "xn--bcher-kva.*", []string{"3"}, ""},
+		{"Unicode", "", "bücher.example.com", []string{"3"}, ""},
+		{"UnicodeGlob", "", "b?cher.*", []string{"3"}, ""},
+		{"NoMatches", "TXT", "", []string{}, ""},
+		{"InvalidType", "PTR", "", nil, "unsupported record type: PTR"},
+		{"InvalidPattern", "", "[example.com", nil, "invalid host pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := filterRecords(testRecords, tt.recordType, tt.hostPattern)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			ids := []string{}
+			for _, rr := range records {
+				ids = append(ids, rr.RecordId)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+}
+
+func TestCheckTypeUnchanged(t *testing.T) {
+	var tests = []struct {
+		name       string
+		recordType string
+		err        string
+	}{
+		{"Same", "a", ""},
+		{"Changed", "CNAME", "can't change the type of record 1 from A to CNAME; delete it and add a new record instead"},
+		{"Invalid", "PTR", "unsupported record type: PTR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTypeUnchanged(testRecords[0], tt.recordType)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	var tests = []struct {
+		name     string
+		format   string
+		expected string
+		err      string
+	}{
+		{
+			"Table", "table",
+			"ID  TYPE   HOST                TTL   DISTANCE  VALUE\n" +
+				"1   A      example.com         7207  0         1.1.1.1\n" +
+				"3   CNAME  bücher.example.com  3600  0         example.com\n",
+			"",
+		},
+		{
+			"JSON", "json",
+			`[
+  {
+    "recordId": "1",
+    "type": "A",
+    "host": "example.com",
+    "value": "1.1.1.1",
+    "ttl": 7207,
+    "distance": 0
+  },
+  {
+    "recordId": "3",
+    "type": "CNAME",
+    "host": "xn--bcher-kva.example.com",
+    "value": "example.com",
+    "ttl": 3600,
+    "distance": 0
+  }
+]
+`,
+			"",
+		},
+		{
+			"YAML", "yaml",
+			`- distance: 0
+  host: example.com
+  recordId: "1"
+  ttl: 7207
+  type: A
+  value: 1.1.1.1
+- distance: 0
+  host: xn--bcher-kva.example.com
+  recordId: "3"
+  ttl: 3600
+  type: CNAME
+  value: example.com
+`,
+			"",
+		},
+		{"Unknown", "csv", "", "unknown output format: csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeRecords(&out, tt.format, []namesilo_api.ResourceRecord{testRecords[0], testRecords[2]})
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	var tests = []struct {
+		name     string
+		yes      bool
+		input    string
+		expected bool
+		output   string
+	}{
+		{"Yes", true, "", true, ""},
+		{"Y", false, "y\n", true, "Delete? [y/N] "},
+		{"YesTyped", false, " YES \n", true, "Delete? [y/N] "},
+		{"No", false, "n\n", false, "Delete? [y/N] Aborted.\n"},
+		{"Empty", false, "\n", false, "Delete? [y/N] Aborted.\n"},
+		{"EOF", false, "", false, "Delete? [y/N] Aborted.\n"},
+		{"Other", false, "yep\n", false, "Delete? [y/N] Aborted.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cmd := &cobra.Command{}
+			cmd.SetIn(strings.NewReader(tt.input))
+			cmd.SetOut(&out)
+
+			assert.Equal(t, tt.expected, confirm(cmd, tt.yes, "Delete?"))
+			assert.Equal(t, tt.output, out.String())
+		})
+	}
+}
@@ -13,6 +13,8 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	rootCmd.AddCommand(updateCommand())
 	rootCmd.AddCommand(watchCommand())
+	rootCmd.AddCommand(zoneCommand())
+	rootCmd.AddCommand(recordsCommand())
 	rootCmd.AddCommand(versionCmd)
 
 	if err := rootCmd.Execute(); err != nil {
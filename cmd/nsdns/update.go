@@ -12,6 +12,16 @@ import (
 func updateCommand() *cobra.Command {
 	var ingressClass string
 	var domainName string
+	var apiKeyFile string
+	var apiKeySecret string
+	var policy string
+	var cnameFlattening bool
+	var conflictPolicy string
+	var protectedHosts []string
+	var gateways []string
+	var gatewayClasses []string
+	var routeKinds []string
+	var services bool
 
 	updateCmd := &cobra.Command{
 		Use:   "update",
@@ -19,11 +29,49 @@ func updateCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.SetLevel(log.DebugLevel)
 
-			dm, err := nsdns.NewDnsManager(domainName, ingressClass)
+			apiKeyLoader, err := GetApiKeyLoader(apiKeyFile, apiKeySecret)
 			if err != nil {
 				return err
 			}
 
+			apiKey, err := apiKeyLoader()
+			if err != nil {
+				return err
+			}
+
+			dm, err := nsdns.NewDnsManagerWithApiKey(domainName, ingressClass, apiKey)
+			if err != nil {
+				return err
+			}
+
+			dm.FlattensCNAMEs = cnameFlattening
+			dm.ConflictPolicy, err = nsdns.ParseConflictPolicy(conflictPolicy)
+			if err != nil {
+				return err
+			}
+
+			if err := ApplySafeguards(dm, policy, protectedHosts, 0); err != nil {
+				return err
+			}
+
+			dm.RouteFilter, err = GetRouteFilter(gateways, gatewayClasses)
+			if err != nil {
+				return err
+			}
+
+			kinds, err := GetRouteKinds(routeKinds)
+			if err != nil {
+				return err
+			}
+
+			if dm.RouteFilter != nil && len(gatewayClasses) != 0 {
+				lister, err := GetGatewayLister()
+				if err != nil {
+					return err
+				}
+				dm.RouteFilter.GatewayClassOf = nsdns.NewGatewayClassLookup(lister)
+			}
+
 			if err := dm.UpdateCache(); err != nil {
 				return err
 			}
@@ -39,11 +87,51 @@ func updateCommand() *cobra.Command {
 				}
 			}
 
+			if services {
+				items, err := GetServices("default")
+				if err != nil {
+					return err
+				}
+
+				for _, s := range items {
+					if err := dm.HandleServiceExists(&s); err != nil {
+						return err
+					}
+				}
+			}
+
+			if dm.RouteFilter == nil {
+				return nil
+			}
+
+			for _, kind := range kinds {
+				routes, err := GetRoutes("default", kind)
+				if err != nil {
+					return err
+				}
+
+				for _, r := range routes {
+					if err := dm.HandleRouteExists(r); err != nil {
+						return err
+					}
+				}
+			}
+
 			return nil
 		},
 	}
 
 	updateCmd.Flags().StringVarP(&ingressClass, "ingress-class", "i", "", "ingress class to use for public DNS records")
 	updateCmd.Flags().StringVarP(&domainName, "domain", "d", "", "domain name for API calls")
+	updateCmd.Flags().StringVar(&apiKeyFile, "api-key-file", "", "file containing the Namesilo API key")
+	updateCmd.Flags().StringVar(&apiKeySecret, "api-key-secret", "", "secret containing the Namesilo API key, as namespace/name:key")
+	updateCmd.Flags().BoolVar(&cnameFlattening, "cname-flattening", false, "publish address records pointing at the public IP instead of CNAMEs to the domain")
+	updateCmd.Flags().StringVar(&conflictPolicy, "conflict-policy", string(nsdns.ConflictPolicyFail), "what to do when other records at the same name prevent creating a record: fail, skip, or replace")
+	updateCmd.Flags().StringVar(&policy, "policy", string(nsdns.PolicySync), "changes allowed to records: sync, upsert-only, or create-only")
+	updateCmd.Flags().StringSliceVar(&protectedHosts, "protected-hosts", []string{}, "hostnames whose records are never updated or deleted, like @ or www")
+	updateCmd.Flags().BoolVar(&services, "services", false, "create DNS records for LoadBalancer services with the "+nsdns.ServiceHostnameAnnotation+" annotation")
+	updateCmd.Flags().StringSliceVar(&gateways, "gateway", []string{}, "Gateway API gateways, as namespace/name, whose routes get DNS records")
+	updateCmd.Flags().StringSliceVar(&gatewayClasses, "gateway-class", []string{}, "Gateway API gateway classes whose gateways' routes get DNS records")
+	updateCmd.Flags().StringSliceVar(&routeKinds, "gateway-route-kinds", []string{"HTTPRoute"}, "kinds of Gateway API routes to create DNS records for: HTTPRoute, GRPCRoute, or TLSRoute")
 	return updateCmd
 }
@@ -9,15 +9,24 @@ import (
 
 import (
 	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
 	apinetworkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/nsdns"
+)
+
 func GetIngresses(namespace string) ([]apinetworkingv1.Ingress, error) {
 	rv := []apinetworkingv1.Ingress{}
 
@@ -37,9 +46,89 @@ func GetIngresses(namespace string) ([]apinetworkingv1.Ingress, error) {
 	return rv, nil
 }
 
+func GetServices(namespace string) ([]apicorev1.Service, error) {
+	rv := []apicorev1.Service{}
+
+	clientset, err := GetKubernetesClientSet()
+	if err != nil {
+		return rv, err
+	}
+
+	items, err := clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return rv, err
+	}
+
+	rv = append(rv, items.Items...)
+
+	return rv, nil
+}
+
+// GetRoutes lists the Gateway API routes of the given kind.
+func GetRoutes(namespace, kind string) ([]*unstructured.Unstructured, error) {
+	rv := []*unstructured.Unstructured{}
+
+	client, err := GetDynamicClient()
+	if err != nil {
+		return rv, err
+	}
+
+	items, err := client.Resource(nsdns.RouteResources[kind]).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return rv, err
+	}
+
+	for i := range items.Items {
+		rv = append(rv, &items.Items[i])
+	}
+
+	return rv, nil
+}
+
+// GetGatewayLister lists every Gateway API gateway once, for looking up their
+// classes.
+func GetGatewayLister() (cache.GenericLister, error) {
+	client, err := GetDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := client.Resource(nsdns.GatewayResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for i := range items.Items {
+		if err := indexer.Add(&items.Items[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return cache.NewGenericLister(indexer, nsdns.GatewayResource.GroupResource()), nil
+}
+
 func GetKubernetesClientSet() (*kubernetes.Clientset, error) {
+	config, err := getKubernetesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+func GetDynamicClient() (*dynamic.DynamicClient, error) {
+	config, err := getKubernetesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(config)
+}
+
+func getKubernetesConfig() (*rest.Config, error) {
 	if config, err := rest.InClusterConfig(); err == nil {
-		return kubernetes.NewForConfig(config)
+		return config, nil
 	} else {
 		log.Info(err.Error())
 	}
@@ -49,10 +138,103 @@ func GetKubernetesClientSet() (*kubernetes.Clientset, error) {
 		kubeconfigPath = path.Join(homedir.HomeDir(), ".kube", "config")
 	}
 	if config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath); err == nil {
-		return kubernetes.NewForConfig(config)
+		return config, nil
 	} else {
 		log.Info(err.Error())
 	}
 
 	return nil, errors.New("failed to configure Kubernetes client")
 }
+
+// GetRouteFilter returns nil when neither gateways nor gateway classes are
+// given, since routes aren't handled at all then.
+func GetRouteFilter(gateways, gatewayClasses []string) (*nsdns.RouteFilter, error) {
+	if len(gateways) == 0 && len(gatewayClasses) == 0 {
+		return nil, nil
+	}
+
+	return nsdns.NewRouteFilter(gateways, gatewayClasses)
+}
+
+// GetRouteKinds parses route kinds, dropping any duplicates.
+func GetRouteKinds(kinds []string) ([]string, error) {
+	rv := []string{}
+	seen := map[string]bool{}
+	for _, k := range kinds {
+		kind, err := nsdns.ParseRouteKind(k)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[kind] {
+			seen[kind] = true
+			rv = append(rv, kind)
+		}
+	}
+
+	return rv, nil
+}
+
+// GetApiKeyLoader returns a loader that reads the Namesilo API key from either
+// a file, a Kubernetes Secret, or the environment, in that order of
+// precedence.
+func GetApiKeyLoader(apiKeyFile, apiKeySecret string) (nsdns.ApiKeyLoader, error) {
+	if apiKeyFile != "" && apiKeySecret != "" {
+		return nil, errors.New("cannot use both --api-key-file and --api-key-secret")
+	}
+
+	if apiKeyFile != "" {
+		return nsdns.ApiKeyFromFile(apiKeyFile), nil
+	}
+
+	if apiKeySecret != "" {
+		ref, err := nsdns.ParseSecretKeyReference(apiKeySecret)
+		if err != nil {
+			return nil, err
+		}
+
+		clientset, err := GetKubernetesClientSet()
+		if err != nil {
+			return nil, err
+		}
+
+		return nsdns.ApiKeyFromSecret(clientset, *ref), nil
+	}
+
+	return nsdns.ApiKeyFromEnvironment(nsdns.ApiKeyEnvironmentVariable), nil
+}
+
+func GetNamesiloApi(domainName, apiKeyFile, apiKeySecret string) (namesilo_api.NamesiloApi, error) {
+	if domainName == "" {
+		return nil, errors.New("must provide a domain name to target DNS record updates")
+	}
+
+	apiKeyLoader, err := GetApiKeyLoader(apiKeyFile, apiKeySecret)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := apiKeyLoader()
+	if err != nil {
+		return nil, err
+	}
+
+	return namesilo_api.NewNamesiloApi(domainName, apiKey), nil
+}
+
+// ApplySafeguards limits the changes the manager can make, as configured by
+// flags.
+func ApplySafeguards(dm *nsdns.DnsManager, policy string, protectedHosts []string, maxDeletesPerSync int) error {
+	p, err := nsdns.ParsePolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	if maxDeletesPerSync < 0 {
+		return errors.New("max deletes per sync cannot be negative")
+	}
+
+	dm.Policy = p
+	dm.MaxDeletesPerSync = maxDeletesPerSync
+	return dm.SetProtectedHosts(protectedHosts)
+}
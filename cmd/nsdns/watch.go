@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -10,18 +14,49 @@ import (
 import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	apinetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 )
 
 import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
 	"github.com/Eagerod/kube-namesilo-dns/pkg/nsdns"
 )
 
+// DefaultShutdownTimeout leaves time to exit within the default termination
+// grace period of 30 seconds.
+const DefaultShutdownTimeout time.Duration = 25 * time.Second
+
 func watchCommand() *cobra.Command {
 	var ingressClass string
 	var domainName string
+	var apiKeyFile string
+	var apiKeySecret string
+	var listenAddress string
+	var readyCacheIntervals int
+	var leaderElect bool
+	var workers int
+	var maxRetries int
+	var leaseName string
+	var leaseNamespace string
+	var refreshInterval time.Duration
+	var retryInterval time.Duration
+	var initialSyncTimeout time.Duration
+	var shutdownTimeout time.Duration
+	var annotateIngresses bool
+	var cleanupFinalizer bool
+	var policy string
+	var cnameFlattening bool
+	var conflictPolicy string
+	var protectedHosts []string
+	var maxDeletesPerSync int
+	var gateways []string
+	var gatewayClasses []string
+	var routeKinds []string
+	var services bool
+	var dnsRecords bool
 
 	watchCmd := &cobra.Command{
 		Use:   "watch",
@@ -29,78 +64,381 @@ func watchCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log.SetLevel(log.DebugLevel)
 
-			dm, err := nsdns.NewDnsManager(domainName, ingressClass)
+			apiKeyLoader, err := GetApiKeyLoader(apiKeyFile, apiKeySecret)
+			if err != nil {
+				return err
+			}
+
+			apiKey, err := apiKeyLoader()
+			if err != nil {
+				return err
+			}
+
+			dm, err := nsdns.NewDnsManagerWithApiKey(domainName, ingressClass, apiKey)
 			if err != nil {
 				return err
 			}
 
 			dm.RefreshesCacheOnUpdate = true
+			dm.FlattensCNAMEs = cnameFlattening
+			dm.ConflictPolicy, err = nsdns.ParseConflictPolicy(conflictPolicy)
+			if err != nil {
+				return err
+			}
+
+			if err := ApplySafeguards(dm, policy, protectedHosts, maxDeletesPerSync); err != nil {
+				return err
+			}
+
+			dm.RouteFilter, err = GetRouteFilter(gateways, gatewayClasses)
+			if err != nil {
+				return err
+			}
+
+			kinds, err := GetRouteKinds(routeKinds)
+			if err != nil {
+				return err
+			}
+
+			dm.Api = metrics.InstrumentApi(dm.Api)
+			if err := metrics.RegisterSyncAge(dm.LastSyncTime); err != nil {
+				return err
+			}
 
 			clientset, err := GetKubernetesClientSet()
 			if err != nil {
 				return err
 			}
 
-			for err := dm.UpdateCache(); err != nil; {
-				log.Errorf("Initial cache update failed with %s. Retrying in 5 minutes...", err.Error())
-				time.Sleep(5 * time.Minute)
+			recorder, stopRecorder := nsdns.NewEventRecorder(clientset)
+			defer stopRecorder()
+			dm.Recorder = recorder
+
+			if annotateIngresses {
+				dm.Annotator = nsdns.NewIngressAnnotator(clientset)
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer cancel()
+
+			if apiKeyFile != "" || apiKeySecret != "" {
+				go nsdns.WatchApiKey(apiKeyLoader, apiKey, nsdns.DefaultApiKeyPollInterval, ctx.Done(), func(apiKey string) {
+					if err := dm.SetApiKey(apiKey); err != nil {
+						log.Error(err)
+					}
+				})
+			}
+
+			informerFactory := informers.NewSharedInformerFactory(clientset, time.Minute)
+			ingressInformer := informerFactory.Networking().V1().Ingresses().Informer()
+			synced := []cache.InformerSynced{ingressInformer.HasSynced}
+
+			controller := nsdns.NewIngressController(dm, informerFactory.Networking().V1().Ingresses())
+			controller.MaxRetries = maxRetries
+			controller.Finalizers = nsdns.NewIngressFinalizerSetter(clientset)
+			controller.AddsFinalizer = cleanupFinalizer
+
+			// Services are only watched when asked for, since doing so needs
+			// permission to.
+			var serviceController *nsdns.ServiceController
+			if services {
+				informer := informerFactory.Core().V1().Services()
+				synced = append(synced, informer.Informer().HasSynced)
+
+				serviceController = nsdns.NewServiceController(dm, informer)
+				serviceController.MaxRetries = maxRetries
+			}
+
+			// Gateway API resources are only watched when routes are handled,
+			// since their CRDs may not be installed.
+			// The same goes for DNSRecords.
+			var dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+			var dynamicClient dynamic.Interface
+			if dm.RouteFilter != nil || dnsRecords {
+				dynamicClient, err = GetDynamicClient()
+				if err != nil {
+					return err
+				}
+
+				dynamicInformerFactory = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, time.Minute)
+			}
+
+			routeControllers := []*nsdns.RouteController{}
+			if dm.RouteFilter != nil {
+				for _, kind := range kinds {
+					informer := dynamicInformerFactory.ForResource(nsdns.RouteResources[kind])
+					synced = append(synced, informer.Informer().HasSynced)
+
+					routeController := nsdns.NewRouteController(dm, kind, informer)
+					routeController.MaxRetries = maxRetries
+					routeControllers = append(routeControllers, routeController)
+				}
+
+				if len(gatewayClasses) != 0 {
+					informer := dynamicInformerFactory.ForResource(nsdns.GatewayResource)
+					synced = append(synced, informer.Informer().HasSynced)
+					dm.RouteFilter.GatewayClassOf = nsdns.NewGatewayClassLookup(informer.Lister())
+				}
+			}
+
+			var dnsRecordController *nsdns.DNSRecordController
+			if dnsRecords {
+				informer := dynamicInformerFactory.ForResource(nsdns.DNSRecordResource)
+				synced = append(synced, informer.Informer().HasSynced)
+
+				dnsRecordController = nsdns.NewDNSRecordController(dm, dynamicClient, informer)
+				dnsRecordController.MaxRetries = maxRetries
+			}
+
+			informersSynced := func() bool {
+				for _, s := range synced {
+					if !s() {
+						return false
+					}
+				}
+
+				return true
+			}
+
+			if listenAddress != "" {
+				maxCacheAge := time.Duration(readyCacheIntervals) * refreshInterval
+				server := &http.Server{
+					Addr:    listenAddress,
+					Handler: nsdns.NewHealthHandler(dm, informersSynced, maxCacheAge),
+				}
+
+				go func() {
+					log.Infof("Serving health checks on %s", listenAddress)
+					if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+						log.Errorf("Health check server failed with %s", err.Error())
+					}
+				}()
+				defer server.Close()
 			}
 
+			refresh := make(chan struct{}, 1)
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
 			go func() {
-				log.Info("Initial cache update complete. Moving to hourly updates...")
-				for {
-					time.Sleep(1 * time.Hour)
-					for err := dm.UpdateCache(); err != nil; {
-						log.Errorf("Hourly cache update failed with %s. Retrying in 5 minutes...", err.Error())
-						time.Sleep(5 * time.Minute)
+				for range hup {
+					select {
+					case refresh <- struct{}{}:
+					default:
 					}
 				}
 			}()
 
-			informerFactory := informers.NewSharedInformerFactory(clientset, time.Minute)
+			// Blocks until ctx is cancelled, or the initial sync times out.
+			run := func(ctx context.Context) error {
+				initialCtx := ctx
+				if initialSyncTimeout > 0 {
+					var cancel context.CancelFunc
+					initialCtx, cancel = context.WithTimeout(ctx, initialSyncTimeout)
+					defer cancel()
+				}
 
-			informerFactory.Networking().V1().Ingresses().Informer().AddEventHandler(
-				cache.ResourceEventHandlerFuncs{
-					AddFunc: func(obj interface{}) {
-						ingress := obj.(*apinetworkingv1.Ingress)
+				if err := dm.UpdateCacheWithRetry(initialCtx, retryInterval); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
 
-						if err := dm.HandleIngressExists(ingress); err != nil {
-							log.Error(err)
-						}
-					},
-					DeleteFunc: func(obj interface{}) {
-						ingress := obj.(*apinetworkingv1.Ingress)
+					return fmt.Errorf("initial cache update did not succeed within %s", initialSyncTimeout)
+				}
 
-						if err := dm.HandleIngressDeleted(ingress); err != nil {
-							log.Error(err)
-						}
-					},
-					UpdateFunc: func(old, new interface{}) {
-						ingress := new.(*apinetworkingv1.Ingress)
+				log.Infof("Initial cache update complete. Refreshing every %s...", refreshInterval)
+				refreshed := make(chan struct{})
+				go func() {
+					dm.RefreshCachePeriodically(ctx, refreshInterval, retryInterval, refresh)
+					close(refreshed)
+				}()
+
+				routesFinished := make(chan error, len(routeControllers))
+				for _, rc := range routeControllers {
+					go func(rc *nsdns.RouteController) {
+						routesFinished <- rc.Run(ctx, workers)
+					}(rc)
+				}
+
+				servicesFinished := make(chan error, 1)
+				if serviceController != nil {
+					go func() {
+						servicesFinished <- serviceController.Run(ctx, workers)
+					}()
+				} else {
+					servicesFinished <- nil
+				}
+
+				dnsRecordsFinished := make(chan error, 1)
+				if dnsRecordController != nil {
+					go func() {
+						dnsRecordsFinished <- dnsRecordController.Run(ctx, workers)
+					}()
+				} else {
+					dnsRecordsFinished <- nil
+				}
+
+				err := controller.Run(ctx, workers)
+				for range routeControllers {
+					if routeErr := <-routesFinished; err == nil {
+						err = routeErr
+					}
+				}
+
+				if serviceErr := <-servicesFinished; err == nil {
+					err = serviceErr
+				}
+
+				if dnsRecordErr := <-dnsRecordsFinished; err == nil {
+					err = dnsRecordErr
+				}
+
+				<-refreshed
+				return err
+			}
+
+			// Followers keep their informers synced too, so that they're ready to
+			// take over as soon as they're elected.
+			informerFactory.Start(ctx.Done())
+			if dynamicInformerFactory != nil {
+				dynamicInformerFactory.Start(ctx.Done())
+			}
+			cache.WaitForCacheSync(ctx.Done(), synced...)
+
+			inFlight := func() []string {
+				keys := controller.InFlight()
+				for _, rc := range routeControllers {
+					keys = append(keys, rc.InFlight()...)
+				}
+
+				if serviceController != nil {
+					keys = append(keys, serviceController.InFlight()...)
+				}
+
+				if dnsRecordController != nil {
+					keys = append(keys, dnsRecordController.InFlight()...)
+				}
+
+				return keys
+			}
+
+			finished := make(chan error, 1)
+			if !leaderElect {
+				go func() {
+					finished <- run(ctx)
+				}()
+
+				select {
+				case err := <-finished:
+					return err
+				case <-ctx.Done():
+					return waitForShutdown(finished, shutdownTimeout, inFlight)
+				}
+			}
+
+			if leaseNamespace == "" {
+				leaseNamespace = nsdns.CurrentNamespace()
+			}
+
+			leConfig, err := nsdns.NewLeaderElectionConfig(leaseName, leaseNamespace)
+			if err != nil {
+				return err
+			}
 
-						if err := dm.HandleIngressExists(ingress); err != nil {
-							log.Error(err)
+			// The lease is held until the leader has finished shutting down, so
+			// that the next one can't start making changes at the same time.
+			electionCtx, stopElection := context.WithCancel(context.Background())
+			defer stopElection()
+
+			dm.SetStandby(true)
+			elected := make(chan error, 1)
+			go func() {
+				elected <- nsdns.RunAsLeader(electionCtx, clientset, *leConfig, func(leaderCtx context.Context) {
+					dm.SetStandby(false)
+
+					runCtx, cancelRun := context.WithCancel(leaderCtx)
+					defer cancelRun()
+					go func() {
+						select {
+						case <-ctx.Done():
+							cancelRun()
+						case <-runCtx.Done():
 						}
-					},
-				},
-			)
+					}()
 
-			stop := make(chan struct{})
-			informerFactory.Start(stop)
-			informerFactory.WaitForCacheSync(stop)
+					finished <- run(runCtx)
+				})
+			}()
 
-			sig := make(chan os.Signal, 1)
-			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			select {
+			case <-ctx.Done():
+				if !dm.Standby() {
+					err = waitForShutdown(finished, shutdownTimeout, inFlight)
+				}
+			case err = <-finished:
+				if err == nil && ctx.Err() == nil {
+					err = fmt.Errorf("lost leadership of lease %s/%s", leaseNamespace, leaseName)
+				}
+			case err = <-elected:
+				if err == nil {
+					err = fmt.Errorf("lost leadership of lease %s/%s", leaseNamespace, leaseName)
+				}
 
-			<-sig
-			stop <- struct{}{}
+				if !dm.Standby() {
+					waitForShutdown(finished, shutdownTimeout, inFlight)
+				}
+			}
 
-			return nil
+			stopElection()
+			<-elected
+			return err
 		},
 	}
 
 	watchCmd.Flags().StringVarP(&ingressClass, "ingress-class", "i", "", "ingress class to use for public DNS records")
 	watchCmd.Flags().StringVarP(&domainName, "domain", "d", "", "domain name for API calls")
+	watchCmd.Flags().StringVar(&apiKeyFile, "api-key-file", "", "file containing the Namesilo API key; reloaded when changed")
+	watchCmd.Flags().StringVar(&apiKeySecret, "api-key-secret", "", "secret containing the Namesilo API key, as namespace/name:key; reloaded when changed")
+	watchCmd.Flags().StringVar(&listenAddress, "listen-address", "", "address to serve /healthz, /readyz, /status, and /metrics on, like :8080")
+	watchCmd.Flags().IntVar(&readyCacheIntervals, "ready-cache-intervals", 3, "number of refresh intervals the cache can go without updating before reporting not ready")
+	watchCmd.Flags().DurationVar(&refreshInterval, "refresh-interval", nsdns.DefaultRefreshInterval, "how often to refresh the cached records and public IP")
+	watchCmd.Flags().DurationVar(&retryInterval, "retry-interval", nsdns.DefaultRefreshRetryInterval, "how long to wait before retrying a failed cache refresh")
+	watchCmd.Flags().DurationVar(&initialSyncTimeout, "initial-sync-timeout", 0, "how long to keep retrying the first cache refresh before exiting; 0 retries forever")
+	watchCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", DefaultShutdownTimeout, "how long to wait for changes in progress to finish when stopping")
+	watchCmd.Flags().BoolVar(&annotateIngresses, "annotate-ingresses", false, "summarize each ingress's records, and the result of the last sync, in its "+nsdns.RecordsAnnotation+" annotation")
+	watchCmd.Flags().BoolVar(&cleanupFinalizer, "cleanup-finalizer", false, "add the "+nsdns.CleanupFinalizer+" finalizer to managed ingresses, so that their records are removed even if they're deleted while nsdns isn't running")
+	watchCmd.Flags().BoolVar(&cnameFlattening, "cname-flattening", false, "publish address records pointing at the public IP instead of CNAMEs to the domain")
+	watchCmd.Flags().StringVar(&conflictPolicy, "conflict-policy", string(nsdns.ConflictPolicyFail), "what to do when other records at the same name prevent creating a record: fail, skip, or replace")
+	watchCmd.Flags().StringVar(&policy, "policy", string(nsdns.PolicySync), "changes allowed to records: sync, upsert-only, or create-only")
+	watchCmd.Flags().StringSliceVar(&protectedHosts, "protected-hosts", []string{}, "hostnames whose records are never updated or deleted, like @ or www")
+	watchCmd.Flags().IntVar(&maxDeletesPerSync, "max-deletes-per-sync", 0, "number of records that can be deleted between cache refreshes before further deletes fail; 0 allows any number")
+	watchCmd.Flags().BoolVar(&services, "services", false, "watch LoadBalancer services with the "+nsdns.ServiceHostnameAnnotation+" annotation, and create DNS records for them")
+	watchCmd.Flags().BoolVar(&dnsRecords, "dns-records", false, "watch DNSRecord resources, and manage the records they ask for; the CRD must be installed")
+	watchCmd.Flags().StringSliceVar(&gateways, "gateway", []string{}, "Gateway API gateways, as namespace/name, whose routes get DNS records")
+	watchCmd.Flags().StringSliceVar(&gatewayClasses, "gateway-class", []string{}, "Gateway API gateway classes whose gateways' routes get DNS records")
+	watchCmd.Flags().StringSliceVar(&routeKinds, "gateway-route-kinds", []string{"HTTPRoute"}, "kinds of Gateway API routes to watch: HTTPRoute, GRPCRoute, or TLSRoute")
+	watchCmd.Flags().IntVar(&workers, "workers", 1, "number of ingresses to handle at once")
+	watchCmd.Flags().IntVar(&maxRetries, "max-retries", nsdns.DefaultMaxRetries, "number of times to retry an ingress that fails, with exponential backoff, before giving up until it changes")
+	watchCmd.Flags().BoolVar(&leaderElect, "leader-elect", false, "only handle ingresses while holding a lease, so that multiple replicas can run")
+	watchCmd.Flags().StringVar(&leaseName, "leader-elect-lease-name", nsdns.DefaultLeaseName, "name of the lease used for leader election")
+	watchCmd.Flags().StringVar(&leaseNamespace, "leader-elect-lease-namespace", "", "namespace of the lease used for leader election; defaults to the pod's namespace")
 
 	return watchCmd
 }
+
+// waitForShutdown waits for changes already being made to finish, and
+// reports what was left undone if they don't finish in time.
+func waitForShutdown(finished <-chan error, timeout time.Duration, inFlight func() []string) error {
+	log.Infof("Shutting down; waiting up to %s for changes in progress to finish...", timeout)
+
+	select {
+	case err := <-finished:
+		log.Info("Shutdown complete")
+		return err
+	case <-time.After(timeout):
+		if keys := inFlight(); len(keys) != 0 {
+			log.Warnf("Abandoned %d resources in progress: %s", len(keys), strings.Join(keys, ", "))
+		}
+
+		return fmt.Errorf("changes in progress did not finish within %s", timeout)
+	}
+}
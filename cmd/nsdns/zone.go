@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/zonefile"
+)
+
+func zoneCommand() *cobra.Command {
+	zoneCmd := &cobra.Command{
+		Use:   "zone",
+		Short: "back up and restore the Namesilo zone as a master file",
+	}
+
+	zoneCmd.AddCommand(zoneExportCommand())
+	zoneCmd.AddCommand(zoneImportCommand())
+
+	return zoneCmd
+}
+
+func zoneExportCommand() *cobra.Command {
+	var domainName string
+	var outputFile string
+	var apiKeyFile string
+	var apiKeySecret string
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "write all records in the zone as an RFC 1035 master file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := GetNamesiloApi(domainName, apiKeyFile, apiKeySecret)
+			if err != nil {
+				return err
+			}
+
+			records, err := api.ListDNSRecords()
+			if err != nil {
+				return err
+			}
+
+			write := func(w io.Writer) error {
+				return zonefile.Write(w, domainName, records)
+			}
+
+			if outputFile == "" || outputFile == "-" {
+				return write(os.Stdout)
+			}
+
+			return writeFileAtomically(outputFile, write)
+		},
+	}
+
+	exportCmd.Flags().StringVarP(&domainName, "domain", "d", "", "domain name for API calls")
+	exportCmd.Flags().StringVarP(&outputFile, "output", "o", "-", "file to write the zone to")
+	exportCmd.Flags().StringVar(&apiKeyFile, "api-key-file", "", "file containing the Namesilo API key")
+	exportCmd.Flags().StringVar(&apiKeySecret, "api-key-secret", "", "secret containing the Namesilo API key, as namespace/name:key")
+
+	return exportCmd
+}
+
+// writeFileAtomically writes a file next to path, and only moves it over path
+// once it's complete, so that a failed export doesn't clobber the last good
+// backup.
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if err := writeAndClose(f, write); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+func writeAndClose(f *os.File, write func(w io.Writer) error) error {
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	// Temporary files are only readable by their owner.
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func zoneImportCommand() *cobra.Command {
+	var domainName string
+	var inputFile string
+	var dryRun bool
+	var prune bool
+	var apiKeyFile string
+	var apiKeySecret string
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "apply the minimal set of changes to make the zone match a master file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			api, err := GetNamesiloApi(domainName, apiKeyFile, apiKeySecret)
+			if err != nil {
+				return err
+			}
+
+			var r io.Reader = os.Stdin
+			if inputFile != "-" {
+				f, err := os.Open(inputFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				r = f
+			}
+
+			desired, err := zonefile.Parse(r, domainName)
+			if err != nil {
+				return err
+			}
+
+			live, err := api.ListDNSRecords()
+			if err != nil {
+				return err
+			}
+
+			plan := zonefile.Diff(live, desired, prune)
+			if err := plan.Write(os.Stdout); err != nil {
+				return err
+			}
+
+			if dryRun || plan.IsEmpty() {
+				return nil
+			}
+
+			log.Info("Applying zone changes...")
+			return plan.Apply(api)
+		},
+	}
+
+	importCmd.Flags().StringVarP(&domainName, "domain", "d", "", "domain name for API calls")
+	importCmd.Flags().StringVarP(&inputFile, "file", "f", "-", "master file to read the zone from")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes that would be made, without making them")
+	importCmd.Flags().BoolVar(&prune, "prune", false, "delete records that aren't in the master file")
+	importCmd.Flags().StringVar(&apiKeyFile, "api-key-file", "", "file containing the Namesilo API key")
+	importCmd.Flags().StringVar(&apiKeySecret, "api-key-secret", "", "secret containing the Namesilo API key, as namespace/name:key")
+
+	return importCmd
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomically(t *testing.T) {
+	var tests = []struct {
+		name     string
+		write    func(w io.Writer) error
+		expected string
+		err      string
+	}{
+		{"Written", func(w io.Writer) error { _, err := fmt.Fprint(w, "new"); return err }, "new", ""},
+		{"Failed", func(w io.Writer) error { fmt.Fprint(w, "partial"); return errors.New("namesilo is down") }, "old", "namesilo is down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "zone.txt")
+			assert.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+
+			err := writeFileAtomically(path, tt.write)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			contents, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(contents))
+
+			// Nothing's left behind.
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"time"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+const (
+	OutcomeSuccess string = "success"
+	OutcomeFailure string = "failure"
+)
+
+type instrumentedApi struct {
+	api namesilo_api.NamesiloApi
+}
+
+// InstrumentApi wraps a Namesilo client so that every call is counted and
+// timed.
+func InstrumentApi(api namesilo_api.NamesiloApi) namesilo_api.NamesiloApi {
+	return &instrumentedApi{api}
+}
+
+func (i *instrumentedApi) ListDNSRecords() ([]namesilo_api.ResourceRecord, error) {
+	var records []namesilo_api.ResourceRecord
+	err := observe("ListDNSRecords", func() (err error) {
+		records, err = i.api.ListDNSRecords()
+		return
+	})
+
+	return records, err
+}
+
+func (i *instrumentedApi) UpdateDNSRecord(rr namesilo_api.ResourceRecord) error {
+	return observe("UpdateDNSRecord", func() error {
+		return i.api.UpdateDNSRecord(rr)
+	})
+}
+
+func (i *instrumentedApi) AddDNSRecord(rr namesilo_api.ResourceRecord) error {
+	return observe("AddDNSRecord", func() error {
+		return i.api.AddDNSRecord(rr)
+	})
+}
+
+func (i *instrumentedApi) DeleteDNSRecord(rr namesilo_api.ResourceRecord) error {
+	return observe("DeleteDNSRecord", func() error {
+		return i.api.DeleteDNSRecord(rr)
+	})
+}
+
+// SetApiKey passes new credentials through to the wrapped client, if it
+// supports them.
+func (i *instrumentedApi) SetApiKey(apiKey string) {
+	if setter, ok := i.api.(namesilo_api.ApiKeySetter); ok {
+		setter.SetApiKey(apiKey)
+	}
+}
+
+func observe(method string, call func() error) error {
+	start := time.Now()
+	err := call()
+	ApiRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	outcome, code := OutcomeSuccess, namesilo_api.SuccessReplyCode
+	if err != nil {
+		outcome, code = OutcomeFailure, ""
+		if replyErr, ok := err.(*namesilo_api.ReplyError); ok {
+			code = replyErr.Code
+		}
+	}
+
+	ApiRequests.WithLabelValues(method, outcome, code).Inc()
+	return err
+}
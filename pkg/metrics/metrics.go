@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace string = "nsdns"
+
+// Registry holds every metric nsdns exports, so that they're served without
+// anything that other libraries may have registered globally.
+var Registry = prometheus.NewRegistry()
+
+var (
+	ApiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "namesilo_api",
+		Name:      "requests_total",
+		Help:      "Namesilo API calls, by method, outcome, and Namesilo reply code.",
+	}, []string{"method", "outcome", "code"})
+
+	ApiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "namesilo_api",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken by Namesilo API calls, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	IngressEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingress_events_total",
+		Help:      "Ingress events seen, by event and whether they were handled, skipped, or failed.",
+	}, []string{"event", "result"})
+
+	ResourceEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resource_events_total",
+		Help:      "Events seen for record sources other than Ingresses, by kind, event, and whether they were handled, skipped, or failed.",
+	}, []string{"kind", "event", "result"})
+
+	RecordChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_changes_total",
+		Help:      "DNS records changed, by action.",
+	}, []string{"action"})
+
+	RecordChangesBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_changes_blocked_total",
+		Help:      "DNS record changes that safeguards prevented, by action and reason.",
+	}, []string{"action", "reason"})
+
+	CacheRefreshDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cache_refresh_duration_seconds",
+		Help:      "Time taken to refresh the cached records and public IP.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	CacheRefreshFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_refresh_failures_total",
+		Help:      "Cache refreshes that failed.",
+	})
+
+	AddressRecordFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "address_record_update_failures_total",
+		Help:      "Address records that couldn't be pointed at a new public IP after a cache refresh.",
+	})
+
+	PublicIP = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "public_ip_info",
+		Help:      "The public IP records are pointed at; always 1, with the address as a label.",
+	}, []string{"ip"})
+
+	LastSuccessfulSync = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_sync_timestamp_seconds",
+		Help:      "Unix time of the last successful cache refresh.",
+	})
+)
+
+const (
+	EventExists  string = "exists"
+	EventDeleted string = "deleted"
+
+	ResultHandled string = "handled"
+	ResultSkipped string = "skipped"
+	ResultFailed  string = "failed"
+
+	ActionCreated string = "created"
+	ActionUpdated string = "updated"
+	ActionDeleted string = "deleted"
+
+	ReasonPolicy     string = "policy"
+	ReasonProtected  string = "protected"
+	ReasonMaxDeletes string = "max-deletes"
+	ReasonConflict   string = "conflict"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ApiRequests,
+		ApiRequestDuration,
+		IngressEvents,
+		ResourceEvents,
+		RecordChanges,
+		RecordChangesBlocked,
+		CacheRefreshDuration,
+		CacheRefreshFailures,
+		AddressRecordFailures,
+		PublicIP,
+		LastSuccessfulSync,
+	)
+}
+
+// RegisterSyncAge exports the time since the last successful sync, computed
+// whenever metrics are scraped.
+func RegisterSyncAge(lastSync func() time.Time) error {
+	return Registry.Register(newSyncAge(lastSync, time.Now))
+}
+
+func newSyncAge(lastSync, now func() time.Time) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "seconds_since_last_successful_sync",
+		Help:      "Seconds since the cache was last refreshed successfully; -1 if it never has been.",
+	}, func() float64 {
+		t := lastSync()
+		if t.IsZero() {
+			return -1
+		}
+
+		return now().Sub(t).Seconds()
+	})
+}
+
+// SetPublicIP replaces the address reported by the public IP gauge.
+func SetPublicIP(ip string) {
+	PublicIP.Reset()
+	PublicIP.WithLabelValues(ip).Set(1)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
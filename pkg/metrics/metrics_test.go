@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+type fakeApi struct {
+	err    error
+	apiKey string
+}
+
+func (f *fakeApi) ListDNSRecords() ([]namesilo_api.ResourceRecord, error) {
+	return []namesilo_api.ResourceRecord{{RecordId: "abc123"}}, f.err
+}
+
+func (f *fakeApi) UpdateDNSRecord(rr namesilo_api.ResourceRecord) error {
+	return f.err
+}
+
+func (f *fakeApi) AddDNSRecord(rr namesilo_api.ResourceRecord) error {
+	return f.err
+}
+
+func (f *fakeApi) DeleteDNSRecord(rr namesilo_api.ResourceRecord) error {
+	return f.err
+}
+
+func (f *fakeApi) SetApiKey(apiKey string) {
+	f.apiKey = apiKey
+}
+
+func TestInstrumentApiSuccess(t *testing.T) {
+	ApiRequests.Reset()
+	api := InstrumentApi(&fakeApi{})
+
+	records, err := api.ListDNSRecords()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", records[0].RecordId)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(ApiRequests.WithLabelValues("ListDNSRecords", OutcomeSuccess, namesilo_api.SuccessReplyCode)))
+}
+
+func TestInstrumentApiReplyError(t *testing.T) {
+	ApiRequests.Reset()
+	api := InstrumentApi(&fakeApi{err: &namesilo_api.ReplyError{Operation: "add", Code: "280", Detail: "Invalid request"}})
+
+	assert.Error(t, api.AddDNSRecord(namesilo_api.ResourceRecord{}))
+	assert.Error(t, api.AddDNSRecord(namesilo_api.ResourceRecord{}))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(ApiRequests.WithLabelValues("AddDNSRecord", OutcomeFailure, "280")))
+}
+
+func TestInstrumentApiTransportError(t *testing.T) {
+	ApiRequests.Reset()
+	api := InstrumentApi(&fakeApi{err: errors.New("connection refused")})
+
+	assert.Error(t, api.DeleteDNSRecord(namesilo_api.ResourceRecord{}))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(ApiRequests.WithLabelValues("DeleteDNSRecord", OutcomeFailure, "")))
+}
+
+func TestInstrumentApiSetApiKey(t *testing.T) {
+	fake := &fakeApi{}
+	api := InstrumentApi(fake)
+
+	setter, ok := api.(namesilo_api.ApiKeySetter)
+	assert.True(t, ok)
+
+	setter.SetApiKey("new-key")
+	assert.Equal(t, "new-key", fake.apiKey)
+}
+
+func TestSetPublicIP(t *testing.T) {
+	SetPublicIP("1.2.3.4")
+	SetPublicIP("5.6.7.8")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(PublicIP))
+	assert.Equal(t, float64(1), testutil.ToFloat64(PublicIP.WithLabelValues("5.6.7.8")))
+}
+
+func TestHandler(t *testing.T) {
+	lastSync := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	syncAge := newSyncAge(func() time.Time { return lastSync }, func() time.Time { return lastSync.Add(90 * time.Second) })
+	assert.NoError(t, Registry.Register(syncAge))
+	defer Registry.Unregister(syncAge)
+
+	SetPublicIP("1.2.3.4")
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	body := new(strings.Builder)
+	_, err = io.Copy(body, resp.Body)
+	assert.NoError(t, err)
+
+	assert.Contains(t, body.String(), `nsdns_public_ip_info{ip="1.2.3.4"} 1`)
+	assert.Contains(t, body.String(), "\nnsdns_seconds_since_last_successful_sync 90\n")
+}
+
+func TestSyncAgeNeverSynced(t *testing.T) {
+	syncAge := newSyncAge(func() time.Time { return time.Time{} }, time.Now)
+	assert.Equal(t, float64(-1), testutil.ToFloat64(syncAge))
+}
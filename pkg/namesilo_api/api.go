@@ -8,10 +8,15 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
+	"sync/atomic"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
 )
 
 const DefaultApiURLPrefix string = "https://www.namesilo.com/api"
+const SuccessReplyCode string = "300"
 
 type NamesiloApi interface {
 	ListDNSRecords() ([]ResourceRecord, error)
@@ -20,8 +25,15 @@ type NamesiloApi interface {
 	DeleteDNSRecord(rr ResourceRecord) error
 }
 
+// ApiKeySetter is implemented by clients whose credentials can be replaced
+// while in use. Requests already in flight keep using the key they started
+// with.
+type ApiKeySetter interface {
+	SetApiKey(apiKey string)
+}
+
 type namesiloApi struct {
-	apiKey    string
+	apiKey    atomic.Value
 	apiPrefix string
 	domain    string
 }
@@ -31,6 +43,7 @@ type ListDNSRecordsResponse struct {
 	Reply   struct {
 		XMLName         xml.Name         `xml:"reply"`
 		ResourceRecords []ResourceRecord `xml:"resource_record"`
+		Code            string           `xml:"code"`
 		Detail          string           `xml:"detail"`
 	}
 }
@@ -39,6 +52,7 @@ type DNSAddRecordsResponse struct {
 	XMLName xml.Name `xml:"namesilo"`
 	Reply   struct {
 		XMLName xml.Name `xml:"reply"`
+		Code    string   `xml:"code"`
 		Detail  string   `xml:"detail"`
 	}
 }
@@ -46,16 +60,34 @@ type DNSAddRecordsResponse struct {
 type DNSUpdateRecordsResponse DNSAddRecordsResponse
 type DNSDeleteRecordsResponse DNSAddRecordsResponse
 
+// ReplyError is returned when Namesilo responds, but reports that the
+// operation failed.
+type ReplyError struct {
+	Operation string
+	Code      string
+	Detail    string
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("namesilo domain %s failed with: %s", e.Operation, e.Detail)
+}
+
 func NewNamesiloApi(domain, apiKey string) NamesiloApi {
 	return NewNamesiloApiWithServer(domain, apiKey, DefaultApiURLPrefix)
 }
 
 func NewNamesiloApiWithServer(domain, apiKey, apiPrefix string) NamesiloApi {
-	return &namesiloApi{
-		apiKey:    apiKey,
+	ns := &namesiloApi{
 		apiPrefix: apiPrefix,
-		domain:    domain,
+		domain:    canonicalHostOrLower(domain),
 	}
+	ns.SetApiKey(apiKey)
+
+	return ns
+}
+
+func (ns *namesiloApi) SetApiKey(apiKey string) {
+	ns.apiKey.Store(apiKey)
 }
 
 func (ns *namesiloApi) ListDNSRecords() ([]ResourceRecord, error) {
@@ -69,10 +101,19 @@ func (ns *namesiloApi) ListDNSRecords() ([]ResourceRecord, error) {
 	if err := request(reqUrl, &ldrr); err != nil {
 		return nil, err
 	} else if ldrr.Reply.Detail != "success" {
-		return nil, fmt.Errorf("namesilo domain list failed with: %s", ldrr.Reply.Detail)
+		return nil, &ReplyError{"list", ldrr.Reply.Code, ldrr.Reply.Detail}
+	}
+
+	records := ldrr.Reply.ResourceRecords
+	for i, rr := range records {
+		if canonical, err := rr.Canonical(ns.domain); err == nil {
+			records[i] = canonical
+		} else {
+			log.Warnf("Namesilo returned record %s with a host that can't be normalized: %s", rr.RecordId, err.Error())
+		}
 	}
 
-	return ldrr.Reply.ResourceRecords, nil
+	return records, nil
 }
 
 func (ns *namesiloApi) UpdateDNSRecord(rr ResourceRecord) error {
@@ -80,17 +121,15 @@ func (ns *namesiloApi) UpdateDNSRecord(rr ResourceRecord) error {
 		return errors.New("cannot update DNS record without record id")
 	}
 
-	if rr.Host == ns.domain {
-		rr.Host = ""
-	} else {
-		domainSuffix := fmt.Sprintf(".%s", ns.domain)
-		rr.Host = strings.TrimSuffix(rr.Host, domainSuffix)
+	rr, err := ns.prepareRecord(rr)
+	if err != nil {
+		return err
 	}
 
 	reqValues := url.Values{}
 
 	reqValues.Add("rrid", rr.RecordId)
-	reqValues.Add("rrtype", rr.Type)
+	reqValues.Add("rrtype", rr.Type.String())
 	reqValues.Add("rrhost", rr.Host)
 	reqValues.Add("rrvalue", rr.Value)
 	reqValues.Add("rrttl", strconv.Itoa(rr.TTL))
@@ -105,7 +144,7 @@ func (ns *namesiloApi) UpdateDNSRecord(rr ResourceRecord) error {
 	if err := request(reqUrl, &durr); err != nil {
 		return err
 	} else if durr.Reply.Detail != "success" {
-		return fmt.Errorf("namesilo domain update failed with: %s", durr.Reply.Detail)
+		return &ReplyError{"update", durr.Reply.Code, durr.Reply.Detail}
 	}
 
 	return nil
@@ -113,16 +152,14 @@ func (ns *namesiloApi) UpdateDNSRecord(rr ResourceRecord) error {
 
 // Adds a resource record to a Namesilo Domain.
 func (ns *namesiloApi) AddDNSRecord(rr ResourceRecord) error {
-	if rr.Host == ns.domain {
-		rr.Host = ""
-	} else {
-		domainSuffix := fmt.Sprintf(".%s", ns.domain)
-		rr.Host = strings.TrimSuffix(rr.Host, domainSuffix)
+	rr, err := ns.prepareRecord(rr)
+	if err != nil {
+		return err
 	}
 
 	reqValues := url.Values{}
 
-	reqValues.Add("rrtype", rr.Type)
+	reqValues.Add("rrtype", rr.Type.String())
 	reqValues.Add("rrhost", rr.Host)
 	reqValues.Add("rrvalue", rr.Value)
 	reqValues.Add("rrttl", strconv.Itoa(rr.TTL))
@@ -137,7 +174,7 @@ func (ns *namesiloApi) AddDNSRecord(rr ResourceRecord) error {
 	if err := request(reqUrl, &darr); err != nil {
 		return err
 	} else if darr.Reply.Detail != "success" {
-		return fmt.Errorf("namesilo domain add failed with: %s", darr.Reply.Detail)
+		return &ReplyError{"add", darr.Reply.Code, darr.Reply.Detail}
 	}
 
 	return nil
@@ -161,12 +198,28 @@ func (ns *namesiloApi) DeleteDNSRecord(rr ResourceRecord) error {
 	if err := request(reqUrl, &ddrr); err != nil {
 		return err
 	} else if ddrr.Reply.Detail != "success" {
-		return fmt.Errorf("namesilo domain delete failed with: %s", ddrr.Reply.Detail)
+		return &ReplyError{"delete", ddrr.Reply.Code, ddrr.Reply.Detail}
 	}
 
 	return nil
 }
 
+// prepareRecord canonicalizes and validates a record, and converts its host
+// to the relative form Namesilo expects.
+func (ns *namesiloApi) prepareRecord(rr ResourceRecord) (ResourceRecord, error) {
+	rr, err := rr.Canonical(ns.domain)
+	if err != nil {
+		return rr, err
+	}
+
+	if err := rr.Validate(); err != nil {
+		return rr, err
+	}
+
+	rr.Host = rr.RelativeHost(ns.domain)
+	return rr, nil
+}
+
 func (ns *namesiloApi) apiActionWithValues(action string, values *url.Values) (*url.URL, error) {
 	reqUrl, err := url.Parse(fmt.Sprintf("%s/%s", ns.apiPrefix, action))
 	if err != nil {
@@ -177,7 +230,7 @@ func (ns *namesiloApi) apiActionWithValues(action string, values *url.Values) (*
 
 	newValues.Add("version", "1")
 	newValues.Add("type", "xml")
-	newValues.Add("key", ns.apiKey)
+	newValues.Add("key", ns.apiKey.Load().(string))
 	newValues.Add("domain", ns.domain)
 
 	reqUrl.RawQuery = newValues.Encode()
@@ -186,15 +239,17 @@ func (ns *namesiloApi) apiActionWithValues(action string, values *url.Values) (*
 }
 
 func request(url_ *url.URL, responseBody interface{}) error {
+	log.Debugf("Sending Namesilo request: GET %s", RedactURL(url_))
+
 	response, err := http.Get(url_.String())
 	if err != nil {
-		return err
+		return redactError(err)
 	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return err
+		return redactError(err)
 	}
 
-	return xml.Unmarshal(body, responseBody)
+	return redactError(xml.Unmarshal(body, responseBody))
 }
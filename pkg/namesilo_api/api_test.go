@@ -303,3 +303,118 @@ func TestDeleteDNSRecordFailsWithoutId(t *testing.T) {
 
 	assert.Equal(t, expectedCalls, calls)
 }
+
+func TestSetApiKey(t *testing.T) {
+	expectedKeys := []string{"api-key", "new-api-key"}
+	keys := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.URL.Query().Get("key"))
+
+		var response ListDNSRecordsResponse
+		response.Reply.Detail = "success"
+		body, err := xml.Marshal(response)
+		assert.NoError(t, err)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	api := NewNamesiloApiWithServer("example.com", "api-key", server.URL)
+	_, err := api.ListDNSRecords()
+	assert.NoError(t, err)
+
+	setter, ok := api.(ApiKeySetter)
+	assert.True(t, ok)
+	setter.SetApiKey("new-api-key")
+
+	_, err = api.ListDNSRecords()
+	assert.NoError(t, err)
+
+	assert.Equal(t, expectedKeys, keys)
+}
+
+func TestListDNSRecordsNormalizesHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response ListDNSRecordsResponse
+		response.Reply.ResourceRecords = append(response.Reply.ResourceRecords, ResourceRecord{
+			RecordId: "abc123",
+			Type:     "CNAME",
+			Host:     "Sub.Example.com.",
+			Value:    "Example.com.",
+		})
+		response.Reply.Detail = "success"
+		body, err := xml.Marshal(response)
+		assert.NoError(t, err)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	api := NewNamesiloApiWithServer("example.com", "api-key", server.URL)
+	rr, err := api.ListDNSRecords()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(rr))
+	assert.Equal(t, "sub.example.com", rr[0].Host)
+	assert.Equal(t, "example.com", rr[0].Value)
+}
+
+func TestAddDNSRecordNormalizesHost(t *testing.T) {
+	expectedCalls := 1
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, []string{"xn--caf-dma"}, q["rrhost"])
+		assert.Equal(t, []string{"example.com"}, q["rrvalue"])
+
+		var response DNSAddRecordsResponse
+		response.Reply.Detail = "success"
+		body, err := xml.Marshal(response)
+		assert.NoError(t, err)
+		w.Write(body)
+
+		calls += 1
+	}))
+	defer server.Close()
+
+	record := ResourceRecord{
+		Type:  "CNAME",
+		Host:  "Café.Example.com.",
+		Value: "Example.com.",
+		TTL:   1234,
+	}
+
+	api := NewNamesiloApiWithServer("example.com", "api-key", server.URL)
+	err := api.AddDNSRecord(record)
+	assert.NoError(t, err)
+
+	assert.Equal(t, expectedCalls, calls)
+}
+
+func TestReplyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response DNSAddRecordsResponse
+		response.Reply.Code = "280"
+		response.Reply.Detail = "Invalid request"
+		body, err := xml.Marshal(response)
+		assert.NoError(t, err)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	record := ResourceRecord{
+		RecordId: "abc123",
+		Type:     "A",
+		Host:     "example.com",
+		Value:    "192.168.1.1",
+		TTL:      1234,
+	}
+
+	api := NewNamesiloApiWithServer("example.com", "api-key", server.URL)
+	err := api.DeleteDNSRecord(record)
+	assert.Equal(t, "namesilo domain delete failed with: Invalid request", err.Error())
+
+	replyErr, ok := err.(*ReplyError)
+	assert.True(t, ok)
+	assert.Equal(t, "280", replyErr.Code)
+}
@@ -0,0 +1,141 @@
+package namesilo_api
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// WildcardLabel matches any name that has no records of its own, when it's
+// the leftmost label of a host, like *.apps.example.com.
+const WildcardLabel string = "*"
+
+// IsWildcard reports whether host is a wildcard name.
+func IsWildcard(host string) bool {
+	return host == WildcardLabel || strings.HasPrefix(host, WildcardLabel+".")
+}
+
+// CanonicalHost lowercases a hostname, strips any trailing dot, and converts
+// Unicode labels to their punycode form, so that the same name always
+// compares equal regardless of where it came from.
+func CanonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" {
+		return "", nil
+	}
+
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if strings.Contains(label, WildcardLabel) {
+			if i != 0 || label != WildcardLabel {
+				return "", fmt.Errorf("invalid hostname %q: a wildcard must be the whole leftmost label", host)
+			}
+			continue
+		}
+
+		if isASCII(label) {
+			labels[i] = strings.ToLower(label)
+			if strings.HasPrefix(labels[i], punycodePrefix) {
+				if err := validatePunycodeLabel(labels[i]); err != nil {
+					return "", fmt.Errorf("invalid hostname %q: %s", host, err.Error())
+				}
+			}
+			continue
+		}
+
+		ascii, err := toASCIILabel(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid hostname %q: %s", host, err.Error())
+		}
+
+		labels[i] = ascii
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// FQDN returns the record's host as a fully qualified name within zone.
+// Hosts that are already qualified are returned in canonical form; an empty
+// host, or "@", refers to the zone apex.
+func (r ResourceRecord) FQDN(zone string) string {
+	host := canonicalHostOrLower(r.Host)
+	zone = canonicalHostOrLower(zone)
+
+	if host == "" || host == "@" {
+		return zone
+	}
+
+	if host == zone || strings.HasSuffix(host, "."+zone) {
+		return host
+	}
+
+	return host + "." + zone
+}
+
+// RelativeHost returns the record's host relative to zone, as Namesilo
+// expects it when adding or updating records. The zone apex is returned as
+// an empty string.
+func (r ResourceRecord) RelativeHost(zone string) string {
+	host := canonicalHostOrLower(r.Host)
+	zone = canonicalHostOrLower(zone)
+
+	if host == zone || host == "@" {
+		return ""
+	}
+
+	return strings.TrimSuffix(host, "."+zone)
+}
+
+// Canonical returns a copy of the record with its host fully qualified within
+// zone, and any hostname value in canonical form.
+func (r ResourceRecord) Canonical(zone string) (ResourceRecord, error) {
+	host, err := CanonicalHost(r.Host)
+	if err != nil {
+		return r, err
+	}
+
+	r.Host = ResourceRecord{Host: host}.FQDN(zone)
+
+	if r.Type.HasHostnameValue() {
+		value, err := CanonicalHost(r.Value)
+		if err != nil {
+			return r, err
+		}
+		r.Value = value
+	}
+
+	return r, nil
+}
+
+// SameTypeAndHost reports whether both records describe the same type of
+// record at the same name.
+func (r ResourceRecord) SameTypeAndHost(other ResourceRecord) bool {
+	return r.Type == other.Type && r.SameHost(other)
+}
+
+// SameHost reports whether both records are at the same name, whatever their
+// types.
+func (r ResourceRecord) SameHost(other ResourceRecord) bool {
+	return canonicalHostOrLower(r.Host) == canonicalHostOrLower(other.Host)
+}
+
+// canonicalHostOrLower is used where a host is only being compared, and an
+// invalid name should still be compared sensibly rather than rejected.
+func canonicalHostOrLower(host string) string {
+	canonical, err := CanonicalHost(host)
+	if err != nil {
+		return strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+
+	return canonical
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
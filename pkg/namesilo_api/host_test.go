@@ -0,0 +1,132 @@
+package namesilo_api
+
+import (
+	"fmt"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalHost(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Empty", "", ""},
+		{"AlreadyCanonical", "sub.example.com", "sub.example.com"},
+		{"Uppercase", "Sub.EXAMPLE.com", "sub.example.com"},
+		{"TrailingDot", "sub.example.com.", "sub.example.com"},
+		{"Whitespace", " sub.example.com ", "sub.example.com"},
+		{"Unicode", "café.example.com", "xn--caf-dma.example.com"},
+		{"UnicodeUppercase", "CAFÉ.example.com", "xn--caf-dma.example.com"},
+		{"Underscore", "_dmarc.example.com", "_dmarc.example.com"},
+		{"Wildcard", "*.Apps.example.com.", "*.apps.example.com"},
+		{"WildcardUnicode", "*.café.example.com", "*.xn--caf-dma.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := CanonicalHost(tt.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, host)
+		})
+	}
+}
+
+func TestCanonicalHostInvalidWildcard(t *testing.T) {
+	for _, host := range []string{"apps.*.example.com", "a*.example.com", "*a.example.com", "*.*.example.com"} {
+		t.Run(host, func(t *testing.T) {
+			_, err := CanonicalHost(host)
+			assert.Equal(t, fmt.Sprintf("invalid hostname %q: a wildcard must be the whole leftmost label", host), err.Error())
+		})
+	}
+}
+
+func TestIsWildcard(t *testing.T) {
+	assert.True(t, IsWildcard("*.example.com"))
+	assert.True(t, IsWildcard("*"))
+	assert.False(t, IsWildcard("sub.example.com"))
+	assert.False(t, IsWildcard("*a.example.com"))
+}
+
+func TestFQDN(t *testing.T) {
+	var tests = []struct {
+		name     string
+		host     string
+		expected string
+	}{
+		{"Apex", "", "example.com"},
+		{"ApexAt", "@", "example.com"},
+		{"ApexQualified", "Example.com.", "example.com"},
+		{"Relative", "sub", "sub.example.com"},
+		{"Qualified", "sub.example.com", "sub.example.com"},
+		{"QualifiedTrailingDot", "SUB.example.com.", "sub.example.com"},
+		{"SuffixOnly", "subexample.com", "subexample.com.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ResourceRecord{Host: tt.host}
+			assert.Equal(t, tt.expected, rr.FQDN("Example.com."))
+		})
+	}
+}
+
+func TestRelativeHost(t *testing.T) {
+	var tests = []struct {
+		name     string
+		host     string
+		expected string
+	}{
+		{"Apex", "example.com", ""},
+		{"ApexTrailingDot", "example.com.", ""},
+		{"ApexAt", "@", ""},
+		{"Qualified", "sub.example.com", "sub"},
+		{"QualifiedUppercase", "Sub.Example.Com.", "sub"},
+		{"Relative", "sub", "sub"},
+		{"Deep", "a.b.example.com", "a.b"},
+		{"Wildcard", "*.apps.example.com", "*.apps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := ResourceRecord{Host: tt.host}
+			assert.Equal(t, tt.expected, rr.RelativeHost("example.com"))
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	rr := ResourceRecord{
+		Type:  RecordTypeCNAME,
+		Host:  "Sub",
+		Value: "Example.com.",
+	}
+
+	canonical, err := rr.Canonical("example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "sub.example.com", canonical.Host)
+	assert.Equal(t, "example.com", canonical.Value)
+
+	rr = ResourceRecord{
+		Type:  RecordTypeTXT,
+		Host:  "example.com.",
+		Value: "Case Sensitive.",
+	}
+
+	canonical, err = rr.Canonical("example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", canonical.Host)
+	assert.Equal(t, "Case Sensitive.", canonical.Value)
+}
+
+func TestSameTypeAndHost(t *testing.T) {
+	rr := ResourceRecord{Type: RecordTypeA, Host: "sub.example.com"}
+
+	assert.True(t, rr.SameTypeAndHost(ResourceRecord{Type: RecordTypeA, Host: "SUB.example.com."}))
+	assert.False(t, rr.SameTypeAndHost(ResourceRecord{Type: RecordTypeAAAA, Host: "sub.example.com"}))
+	assert.False(t, rr.SameTypeAndHost(ResourceRecord{Type: RecordTypeA, Host: "other.example.com"}))
+
+	assert.True(t, rr.SameHost(ResourceRecord{Type: RecordTypeTXT, Host: "SUB.example.com."}))
+	assert.False(t, rr.SameHost(ResourceRecord{Type: RecordTypeA, Host: "other.example.com"}))
+}
@@ -0,0 +1,155 @@
+package namesilo_api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+import (
+	"golang.org/x/net/idna"
+)
+
+const punycodePrefix string = "xn--"
+
+// Scripts that are commonly written together, and so may share a label
+// without it being a likely homograph. Any other label must stick to a single
+// script, ignoring characters like digits that are common to all scripts.
+var allowedScriptCombinations = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// DisplayHost converts any punycode labels in host back to Unicode, for use in
+// logs and other human-facing output. Hosts that can't be decoded are returned
+// unchanged.
+func DisplayHost(host string) string {
+	if IsWildcard(host) && host != WildcardLabel {
+		return WildcardLabel + "." + DisplayHost(strings.TrimPrefix(host, WildcardLabel+"."))
+	}
+
+	display, err := idna.Lookup.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+
+	return display
+}
+
+// toASCIILabel converts a single Unicode label to its punycode form.
+func toASCIILabel(label string) (string, error) {
+	ascii, err := idna.Lookup.ToASCII(label)
+	if err != nil {
+		return "", err
+	}
+
+	unicodeLabel, err := idna.Lookup.ToUnicode(ascii)
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateUnicodeLabel(unicodeLabel); err != nil {
+		return "", err
+	}
+
+	return ascii, nil
+}
+
+// validatePunycodeLabel checks that an xn-- label decodes to a valid Unicode
+// label, and that it's the form that label would be encoded as.
+func validatePunycodeLabel(label string) error {
+	unicodeLabel, err := idna.Lookup.ToUnicode(label)
+	if err != nil {
+		return err
+	}
+
+	if isASCII(unicodeLabel) {
+		return fmt.Errorf("label %q doesn't decode to an internationalized label", label)
+	}
+
+	if err := validateUnicodeLabel(unicodeLabel); err != nil {
+		return err
+	}
+
+	ascii, err := idna.Lookup.ToASCII(unicodeLabel)
+	if err != nil {
+		return err
+	}
+
+	if ascii != label {
+		return fmt.Errorf("label %q is not in canonical form; expected %q", label, ascii)
+	}
+
+	return nil
+}
+
+// validateUnicodeLabel rejects symbols, like emoji, that IDNA2008 disallows,
+// and labels that mix scripts in ways that make them easy to spoof.
+func validateUnicodeLabel(label string) error {
+	scripts := map[string]bool{}
+	for _, c := range label {
+		if c == '-' || unicode.IsDigit(c) || unicode.IsMark(c) {
+			continue
+		}
+
+		if !unicode.IsLetter(c) {
+			return fmt.Errorf("label %q contains disallowed character %q", label, c)
+		}
+
+		if script := scriptOf(c); script != "" {
+			scripts[script] = true
+		}
+	}
+
+	if len(scripts) <= 1 {
+		return nil
+	}
+
+	for _, allowed := range allowedScriptCombinations {
+		if containsAll(allowed, scripts) {
+			return nil
+		}
+	}
+
+	names := []string{}
+	for script := range scripts {
+		names = append(names, script)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("label %q mixes %s scripts", label, strings.Join(names, " and "))
+}
+
+func scriptOf(c rune) string {
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+
+		if unicode.Is(table, c) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func containsAll(allowed []string, scripts map[string]bool) bool {
+	for script := range scripts {
+		found := false
+		for _, a := range allowed {
+			if a == script {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package namesilo_api
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalHostInternationalized(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected string
+		errorMsg string
+	}{
+		{"Latin", "café.example.com", "xn--caf-dma.example.com", ""},
+		{"LatinSharpS", "straße.example.com", "xn--strae-oqa.example.com", ""},
+		{"Cyrillic", "пример.example.com", "xn--e1afmkfd.example.com", ""},
+		{"CyrillicWithDigits", "пример1.example.com", "xn--1-itbiqngd.example.com", ""},
+		{"Greek", "δοκιμή.example.com", "xn--jxalpdlp.example.com", ""},
+		{"Hebrew", "שלום.example.com", "xn--9dbne9b.example.com", ""},
+		{"Han", "例子.example.com", "xn--fsqu00a.example.com", ""},
+		{"Japanese", "ひらがなカタカナ漢字.example.com", "xn--v8j0cwa6gzha3lrdr510cymwb.example.com", ""},
+		{"JapaneseWithLatin", "東京abc.example.com", "xn--abc-dm9di64i.example.com", ""},
+		{"KoreanWithLatin", "한국abc.example.com", "xn--abc-lt8lk11n.example.com", ""},
+		{"MixedLabels", "пример.café.example.com", "xn--e1afmkfd.xn--caf-dma.example.com", ""},
+		{"Punycode", "xn--caf-dma.example.com", "xn--caf-dma.example.com", ""},
+		{"PunycodeUppercase", "XN--CAF-DMA.example.com", "xn--caf-dma.example.com", ""},
+		{"CyrillicAndLatin", "рaypal.example.com", "", `invalid hostname "рaypal.example.com": label "рaypal" mixes Cyrillic and Latin scripts`},
+		{"GreekAndLatin", "αpple.example.com", "", `invalid hostname "αpple.example.com": label "αpple" mixes Greek and Latin scripts`},
+		{"CyrillicAndGreek", "пδ.example.com", "", `invalid hostname "пδ.example.com": label "пδ" mixes Cyrillic and Greek scripts`},
+		{"HangulAndKatakana", "한국カタカナ.example.com", "", `invalid hostname "한국カタカナ.example.com": label "한국カタカナ" mixes Hangul and Katakana scripts`},
+		{"LatinAndHebrew", "abcא.example.com", "", `invalid hostname "abcא.example.com": idna: invalid label "abcא"`},
+		{"Emoji", "😀.example.com", "", `invalid hostname "😀.example.com": label "😀" contains disallowed character '😀'`},
+		{"PunycodeEmoji", "xn--e28h.example.com", "", `invalid hostname "xn--e28h.example.com": label "😀" contains disallowed character '😀'`},
+		{"PunycodeMixedScript", "xn--aypal-uye.example.com", "", `invalid hostname "xn--aypal-uye.example.com": label "рaypal" mixes Cyrillic and Latin scripts`},
+		{"PunycodeInvalid", "xn--a.example.com", "", `invalid hostname "xn--a.example.com": idna: invalid label "\u0080"`},
+		{"PunycodeOfASCII", "xn--zz-.example.com", "", `invalid hostname "xn--zz-.example.com": label "xn--zz-" doesn't decode to an internationalized label`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := CanonicalHost(tt.input)
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, host)
+			} else {
+				assert.Equal(t, tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestDisplayHost(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"ASCII", "sub.example.com", "sub.example.com"},
+		{"Punycode", "xn--caf-dma.example.com", "café.example.com"},
+		{"MultiplePunycode", "xn--e1afmkfd.xn--caf-dma.example.com", "пример.café.example.com"},
+		{"Invalid", "xn--a.example.com", "xn--a.example.com"},
+		{"Wildcard", "*.xn--caf-dma.example.com", "*.café.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DisplayHost(tt.input))
+		})
+	}
+}
+
+func TestIDNRoundTrip(t *testing.T) {
+	for _, host := range []string{"café.example.com", "пример.example.com", "例子.example.com", "한국abc.example.com"} {
+		canonical, err := CanonicalHost(host)
+		assert.NoError(t, err)
+		assert.Equal(t, host, DisplayHost(canonical))
+	}
+}
@@ -0,0 +1,61 @@
+package namesilo_api
+
+import (
+	"fmt"
+	"strings"
+)
+
+type RecordType string
+
+const (
+	RecordTypeA     RecordType = "A"
+	RecordTypeAAAA  RecordType = "AAAA"
+	RecordTypeCNAME RecordType = "CNAME"
+	RecordTypeMX    RecordType = "MX"
+	RecordTypeTXT   RecordType = "TXT"
+	RecordTypeSRV   RecordType = "SRV"
+	RecordTypeCAA   RecordType = "CAA"
+	RecordTypeNS    RecordType = "NS"
+)
+
+// RecordTypes lists every record type Namesilo supports.
+var RecordTypes = []RecordType{
+	RecordTypeA,
+	RecordTypeAAAA,
+	RecordTypeCNAME,
+	RecordTypeMX,
+	RecordTypeTXT,
+	RecordTypeSRV,
+	RecordTypeCAA,
+	RecordTypeNS,
+}
+
+// ParseRecordType converts a case-insensitive record type name into a
+// RecordType.
+func ParseRecordType(s string) (RecordType, error) {
+	rt := RecordType(strings.ToUpper(strings.TrimSpace(s)))
+	if !rt.IsValid() {
+		return "", fmt.Errorf("unsupported record type: %s", s)
+	}
+
+	return rt, nil
+}
+
+func (rt RecordType) IsValid() bool {
+	for _, t := range RecordTypes {
+		if rt == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rt RecordType) String() string {
+	return string(rt)
+}
+
+// HasHostnameValue reports whether records of this type point at another name.
+func (rt RecordType) HasHostnameValue() bool {
+	return rt == RecordTypeCNAME || rt == RecordTypeMX || rt == RecordTypeNS
+}
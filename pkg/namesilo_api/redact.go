@@ -0,0 +1,55 @@
+package namesilo_api
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const RedactedValue string = "REDACTED"
+
+var apiKeyPattern = regexp.MustCompile(`\bkey=[^&\s"']*`)
+
+// Redact replaces the value of any key= query parameter found in s, so that
+// URLs built for the Namesilo API can be safely logged.
+func Redact(s string) string {
+	return apiKeyPattern.ReplaceAllString(s, "key="+RedactedValue)
+}
+
+// RedactURL returns the string form of a request URL with the API key removed.
+func RedactURL(u *url.URL) string {
+	return Redact(u.String())
+}
+
+type redactedError struct {
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+// redactError scrubs the API key from errors produced while talking to the
+// Namesilo API. *url.Error values are rebuilt so that callers can still
+// inspect them; any other error that leaks the key is flattened to its
+// redacted message, and deliberately doesn't unwrap to the original.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if urlErr, ok := err.(*url.Error); ok {
+		return &url.Error{
+			Op:  urlErr.Op,
+			URL: Redact(urlErr.URL),
+			Err: redactError(urlErr.Err),
+		}
+	}
+
+	message := err.Error()
+	if !strings.Contains(message, "key=") {
+		return err
+	}
+
+	return &redactedError{Redact(message)}
+}
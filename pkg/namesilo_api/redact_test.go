@@ -0,0 +1,76 @@
+package namesilo_api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"NoKey", "https://example.com/api?domain=example.com", "https://example.com/api?domain=example.com"},
+		{"FirstParam", "https://example.com/api?key=abc123&domain=example.com", "https://example.com/api?key=REDACTED&domain=example.com"},
+		{"LastParam", "https://example.com/api?domain=example.com&key=abc123", "https://example.com/api?domain=example.com&key=REDACTED"},
+		{"InMessage", `Get "https://example.com/api?key=abc123": EOF`, `Get "https://example.com/api?key=REDACTED": EOF`},
+		{"OtherParam", "https://example.com/api?monkey=abc123", "https://example.com/api?monkey=abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Redact(tt.input))
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	assert.Nil(t, redactError(nil))
+
+	err := errors.New("nothing to see here")
+	assert.Equal(t, err, redactError(err))
+
+	err = &url.Error{Op: "Get", URL: "https://example.com/api?key=abc123", Err: errors.New("key=abc123")}
+	redacted := redactError(err)
+	assert.IsType(t, &url.Error{}, redacted)
+	assert.Equal(t, `Get "https://example.com/api?key=REDACTED": key=REDACTED`, redacted.Error())
+}
+
+func TestRequestErrorsDoNotContainApiKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	api := NewNamesiloApiWithServer("example.com", "super-secret-api-key", server.URL)
+
+	_, err := api.ListDNSRecords()
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "super-secret-api-key")
+	assert.Contains(t, err.Error(), "key=REDACTED")
+
+	record := ResourceRecord{
+		RecordId: "abc123",
+		Type:     "A",
+		Host:     "sub.example.com",
+		Value:    "192.168.1.1",
+		TTL:      1234,
+	}
+
+	err = api.AddDNSRecord(record)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "super-secret-api-key")
+
+	err = api.UpdateDNSRecord(record)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "super-secret-api-key")
+
+	err = api.DeleteDNSRecord(record)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "super-secret-api-key")
+}
@@ -4,14 +4,17 @@ import (
 	"encoding/xml"
 )
 
+// DefaultTTL is the TTL Namesilo assigns to records when none is given.
+const DefaultTTL int = 7207
+
 type ResourceRecord struct {
-	XMLName  xml.Name `xml:"resource_record"`
-	RecordId string   `xml:"record_id"`
-	Type     string   `xml:"type"`
-	Host     string   `xml:"host"`
-	Value    string   `xml:"value"`
-	TTL      int      `xml:"ttl"`
-	Distance int      `xml:"distance"`
+	XMLName  xml.Name   `xml:"resource_record" json:"-"`
+	RecordId string     `xml:"record_id" json:"recordId"`
+	Type     RecordType `xml:"type" json:"type"`
+	Host     string     `xml:"host" json:"host"`
+	Value    string     `xml:"value" json:"value"`
+	TTL      int        `xml:"ttl" json:"ttl"`
+	Distance int        `xml:"distance" json:"distance"`
 }
 
 func (r ResourceRecord) Equals(other interface{}) bool {
@@ -37,10 +40,14 @@ func (r ResourceRecord) EqualsRecord(other ResourceRecord) bool {
 	if r.RecordId != "" && other.RecordId != "" {
 		matchIds = r.RecordId == other.RecordId
 	}
+	value, otherValue := r.Value, other.Value
+	if r.Type.HasHostnameValue() {
+		value, otherValue = canonicalHostOrLower(value), canonicalHostOrLower(otherValue)
+	}
+
 	return matchIds &&
-		r.Type == other.Type &&
-		r.Host == other.Host &&
-		r.Value == other.Value &&
+		r.SameTypeAndHost(other) &&
+		value == otherValue &&
 		r.TTL == other.TTL &&
 		r.Distance == other.Distance
 }
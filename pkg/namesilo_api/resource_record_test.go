@@ -39,6 +39,13 @@ func TestEquals(t *testing.T) {
 		TTL:      1234,
 		Distance: 0,
 	}
+	rrNoIDUppercase := ResourceRecord{
+		Type:     "CNAME",
+		Host:     "Sub.Example.com.",
+		Value:    "EXAMPLE.com.",
+		TTL:      1234,
+		Distance: 0,
+	}
 	var tests = []struct {
 		name      string
 		input     ResourceRecord
@@ -51,6 +58,7 @@ func TestEquals(t *testing.T) {
 		{"EqualDifferentIds", rrWithID1, rrWithID2, false},
 		{"EqualDifferentProps", rrNoID1, rrNoID2, false},
 		{"EqualOneMissingId", rrWithID1, rrNoID1, true},
+		{"EqualDifferentCase", rrNoID1, rrNoIDUppercase, true},
 		{"EqualWithNil", rrWithID1, nil, false},
 		{"EqualWithOtherType", rrWithID1, "Legit Resource Record", false},
 	}
@@ -0,0 +1,174 @@
+package namesilo_api
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const MaxHostnameLength int = 253
+const MaxLabelLength int = 63
+const MaxTXTValueLength int = 2048
+
+// Validate checks that a record is well-formed for its type, so that obviously
+// broken records are rejected before they're sent to Namesilo.
+// MX and SRV priorities are taken from Distance; SRV values are expected as
+// "weight port target", and CAA values as "flags tag value".
+func (r ResourceRecord) Validate() error {
+	if !r.Type.IsValid() {
+		return fmt.Errorf("invalid record for %q: unsupported record type %q", r.Host, r.Type)
+	}
+
+	if r.Host != "" {
+		if err := ValidateHostname(r.Host); err != nil {
+			return r.validationError("host %s", err.Error())
+		}
+	}
+
+	if r.TTL < 0 {
+		return r.validationError("ttl %d cannot be negative", r.TTL)
+	}
+
+	if r.Distance < 0 || r.Distance > 65535 {
+		return r.validationError("distance %d must be between 0 and 65535", r.Distance)
+	}
+
+	switch r.Type {
+	case RecordTypeA:
+		ip := net.ParseIP(r.Value)
+		if ip == nil || ip.To4() == nil || strings.Contains(r.Value, ":") {
+			return r.validationError("value %q is not an IPv4 address", r.Value)
+		}
+	case RecordTypeAAAA:
+		ip := net.ParseIP(r.Value)
+		if ip == nil || ip.To4() != nil {
+			return r.validationError("value %q is not an IPv6 address", r.Value)
+		}
+	case RecordTypeCNAME, RecordTypeMX, RecordTypeNS:
+		if err := ValidateHostname(r.Value); err != nil {
+			return r.validationError("value %s", err.Error())
+		}
+		if IsWildcard(r.Value) {
+			return r.validationError("value %q cannot be a wildcard", r.Value)
+		}
+	case RecordTypeTXT:
+		if r.Value == "" {
+			return r.validationError("value cannot be empty")
+		}
+		if len(r.Value) > MaxTXTValueLength {
+			return r.validationError("value is %d characters long, longer than the maximum of %d", len(r.Value), MaxTXTValueLength)
+		}
+		for _, c := range r.Value {
+			if c < ' ' || c > '~' {
+				return r.validationError("value contains non-printable character %q", c)
+			}
+		}
+	case RecordTypeSRV:
+		return r.validateSRV()
+	case RecordTypeCAA:
+		return r.validateCAA()
+	}
+
+	return nil
+}
+
+func (r ResourceRecord) validateSRV() error {
+	fields := strings.Fields(r.Value)
+	if len(fields) != 3 {
+		return r.validationError("value %q must be in the form \"weight port target\"", r.Value)
+	}
+
+	if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+		return r.validationError("weight %q must be between 0 and 65535", fields[0])
+	}
+
+	if _, err := strconv.ParseUint(fields[1], 10, 16); err != nil {
+		return r.validationError("port %q must be between 0 and 65535", fields[1])
+	}
+
+	if fields[2] != "." {
+		if err := ValidateHostname(fields[2]); err != nil {
+			return r.validationError("target %s", err.Error())
+		}
+		if IsWildcard(fields[2]) {
+			return r.validationError("target %q cannot be a wildcard", fields[2])
+		}
+	}
+
+	return nil
+}
+
+func (r ResourceRecord) validateCAA() error {
+	fields := strings.SplitN(r.Value, " ", 3)
+	if len(fields) != 3 {
+		return r.validationError("value %q must be in the form \"flags tag value\"", r.Value)
+	}
+
+	if _, err := strconv.ParseUint(fields[0], 10, 8); err != nil {
+		return r.validationError("flags %q must be between 0 and 255", fields[0])
+	}
+
+	tag := fields[1]
+	if len(tag) == 0 || len(tag) > 15 {
+		return r.validationError("tag %q must be between 1 and 15 characters long", tag)
+	}
+	for _, c := range tag {
+		if !isAlphanumeric(c) {
+			return r.validationError("tag %q must be alphanumeric", tag)
+		}
+	}
+
+	if strings.Trim(fields[2], "\"") == "" {
+		return r.validationError("value for tag %s cannot be empty", tag)
+	}
+
+	return nil
+}
+
+func (r ResourceRecord) validationError(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid %s record for %q: %s", r.Type, r.Host, fmt.Sprintf(format, args...))
+}
+
+// ValidateHostname checks that name is a syntactically valid DNS name.
+// Underscores are permitted, since service labels like _dmarc use them, as is
+// a wildcard leftmost label.
+func ValidateHostname(name string) error {
+	trimmed := strings.TrimSuffix(name, ".")
+	if trimmed == "" {
+		return fmt.Errorf("%q is not a valid hostname", name)
+	}
+
+	if len(trimmed) > MaxHostnameLength {
+		return fmt.Errorf("%q is longer than %d characters", name, MaxHostnameLength)
+	}
+
+	for i, label := range strings.Split(trimmed, ".") {
+		if strings.Contains(label, WildcardLabel) {
+			if i != 0 || label != WildcardLabel {
+				return fmt.Errorf("%q has a wildcard that isn't the whole leftmost label", name)
+			}
+			continue
+		}
+
+		if len(label) == 0 || len(label) > MaxLabelLength {
+			return fmt.Errorf("%q has a label that isn't between 1 and %d characters long", name, MaxLabelLength)
+		}
+
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%q has a label that starts or ends with a hyphen", name)
+		}
+
+		for _, c := range label {
+			if !isAlphanumeric(c) && c != '-' && c != '_' {
+				return fmt.Errorf("%q contains invalid character %q", name, c)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isAlphanumeric(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,101 @@
+package namesilo_api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecordType(t *testing.T) {
+	rt, err := ParseRecordType("cname")
+	assert.NoError(t, err)
+	assert.Equal(t, RecordTypeCNAME, rt)
+
+	_, err = ParseRecordType("PTR")
+	assert.Equal(t, "unsupported record type: PTR", err.Error())
+}
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		record   ResourceRecord
+		errorMsg string
+	}{
+		{"A", ResourceRecord{Type: RecordTypeA, Host: "example.com", Value: "1.2.3.4"}, ""},
+		{"AInvalid", ResourceRecord{Type: RecordTypeA, Host: "example.com", Value: "1.2.3"}, `invalid A record for "example.com": value "1.2.3" is not an IPv4 address`},
+		{"AWithIPv6", ResourceRecord{Type: RecordTypeA, Host: "example.com", Value: "::1"}, `invalid A record for "example.com": value "::1" is not an IPv4 address`},
+		{"AWithMappedIPv4", ResourceRecord{Type: RecordTypeA, Host: "example.com", Value: "::ffff:1.2.3.4"}, `invalid A record for "example.com": value "::ffff:1.2.3.4" is not an IPv4 address`},
+		{"AAAA", ResourceRecord{Type: RecordTypeAAAA, Host: "example.com", Value: "2001:db8::1"}, ""},
+		{"AAAAWithIPv4", ResourceRecord{Type: RecordTypeAAAA, Host: "example.com", Value: "1.2.3.4"}, `invalid AAAA record for "example.com": value "1.2.3.4" is not an IPv6 address`},
+		{"CNAME", ResourceRecord{Type: RecordTypeCNAME, Host: "sub.example.com", Value: "example.com"}, ""},
+		{"CNAMEInvalid", ResourceRecord{Type: RecordTypeCNAME, Host: "sub.example.com", Value: "exa mple.com"}, `invalid CNAME record for "sub.example.com": value "exa mple.com" contains invalid character ' '`},
+		{"MX", ResourceRecord{Type: RecordTypeMX, Host: "example.com", Value: "mail.example.com", Distance: 10}, ""},
+		{"MXBadDistance", ResourceRecord{Type: RecordTypeMX, Host: "example.com", Value: "mail.example.com", Distance: 65536}, `invalid MX record for "example.com": distance 65536 must be between 0 and 65535`},
+		{"NS", ResourceRecord{Type: RecordTypeNS, Host: "sub.example.com", Value: "ns1.example.net."}, ""},
+		{"NSHyphen", ResourceRecord{Type: RecordTypeNS, Host: "sub.example.com", Value: "-ns1.example.net"}, `invalid NS record for "sub.example.com": value "-ns1.example.net" has a label that starts or ends with a hyphen`},
+		{"TXT", ResourceRecord{Type: RecordTypeTXT, Host: "_dmarc.example.com", Value: "v=DMARC1; p=none"}, ""},
+		{"TXTEmpty", ResourceRecord{Type: RecordTypeTXT, Host: "example.com", Value: ""}, `invalid TXT record for "example.com": value cannot be empty`},
+		{"TXTTooLong", ResourceRecord{Type: RecordTypeTXT, Host: "example.com", Value: strings.Repeat("a", MaxTXTValueLength+1)}, `invalid TXT record for "example.com": value is 2049 characters long, longer than the maximum of 2048`},
+		{"TXTNonPrintable", ResourceRecord{Type: RecordTypeTXT, Host: "example.com", Value: "a\nb"}, `invalid TXT record for "example.com": value contains non-printable character '\n'`},
+		{"SRV", ResourceRecord{Type: RecordTypeSRV, Host: "_sip._tcp.example.com", Value: "5 5060 sip.example.com", Distance: 10}, ""},
+		{"SRVNoTarget", ResourceRecord{Type: RecordTypeSRV, Host: "_sip._tcp.example.com", Value: "0 0 ."}, ""},
+		{"SRVMissingFields", ResourceRecord{Type: RecordTypeSRV, Host: "_sip._tcp.example.com", Value: "5060 sip.example.com"}, `invalid SRV record for "_sip._tcp.example.com": value "5060 sip.example.com" must be in the form "weight port target"`},
+		{"SRVBadPort", ResourceRecord{Type: RecordTypeSRV, Host: "_sip._tcp.example.com", Value: "5 70000 sip.example.com"}, `invalid SRV record for "_sip._tcp.example.com": port "70000" must be between 0 and 65535`},
+		{"SRVBadWeight", ResourceRecord{Type: RecordTypeSRV, Host: "_sip._tcp.example.com", Value: "-1 5060 sip.example.com"}, `invalid SRV record for "_sip._tcp.example.com": weight "-1" must be between 0 and 65535`},
+		{"CAA", ResourceRecord{Type: RecordTypeCAA, Host: "example.com", Value: `0 issue "letsencrypt.org"`}, ""},
+		{"CAABadFlags", ResourceRecord{Type: RecordTypeCAA, Host: "example.com", Value: `256 issue "letsencrypt.org"`}, `invalid CAA record for "example.com": flags "256" must be between 0 and 255`},
+		{"CAABadTag", ResourceRecord{Type: RecordTypeCAA, Host: "example.com", Value: `0 is-sue "letsencrypt.org"`}, `invalid CAA record for "example.com": tag "is-sue" must be alphanumeric`},
+		{"CAAEmptyValue", ResourceRecord{Type: RecordTypeCAA, Host: "example.com", Value: `0 issue ""`}, `invalid CAA record for "example.com": value for tag issue cannot be empty`},
+		{"UnknownType", ResourceRecord{Type: "PTR", Host: "example.com", Value: "example.com"}, `invalid record for "example.com": unsupported record type "PTR"`},
+		{"BadHost", ResourceRecord{Type: RecordTypeA, Host: "sub..example.com", Value: "1.2.3.4"}, `invalid A record for "sub..example.com": host "sub..example.com" has a label that isn't between 1 and 63 characters long`},
+		{"WildcardHost", ResourceRecord{Type: RecordTypeCNAME, Host: "*.apps.example.com", Value: "example.com"}, ""},
+		{"WildcardNotLeftmost", ResourceRecord{Type: RecordTypeCNAME, Host: "apps.*.example.com", Value: "example.com"}, `invalid CNAME record for "apps.*.example.com": host "apps.*.example.com" has a wildcard that isn't the whole leftmost label`},
+		{"WildcardPartialLabel", ResourceRecord{Type: RecordTypeCNAME, Host: "a*.example.com", Value: "example.com"}, `invalid CNAME record for "a*.example.com": host "a*.example.com" has a wildcard that isn't the whole leftmost label`},
+		{"WildcardValue", ResourceRecord{Type: RecordTypeCNAME, Host: "sub.example.com", Value: "*.example.com"}, `invalid CNAME record for "sub.example.com": value "*.example.com" cannot be a wildcard`},
+		{"WildcardTarget", ResourceRecord{Type: RecordTypeSRV, Host: "_sip._tcp.example.com", Value: "5 5060 *.example.com"}, `invalid SRV record for "_sip._tcp.example.com": target "*.example.com" cannot be a wildcard`},
+		{"NegativeTTL", ResourceRecord{Type: RecordTypeA, Host: "example.com", Value: "1.2.3.4", TTL: -1}, `invalid A record for "example.com": ttl -1 cannot be negative`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.record.Validate()
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestInvalidRecordsAreNotSent(t *testing.T) {
+	expectedCalls := 0
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls += 1
+	}))
+	defer server.Close()
+
+	record := ResourceRecord{
+		RecordId: "abc123",
+		Type:     RecordTypeA,
+		Host:     "sub.example.com",
+		Value:    "example.com",
+		TTL:      1234,
+	}
+
+	api := NewNamesiloApiWithServer("example.com", "api-key", server.URL)
+
+	err := api.AddDNSRecord(record)
+	assert.Equal(t, `invalid A record for "sub.example.com": value "example.com" is not an IPv4 address`, err.Error())
+
+	err = api.UpdateDNSRecord(record)
+	assert.Equal(t, `invalid A record for "sub.example.com": value "example.com" is not an IPv4 address`, err.Error())
+
+	assert.Equal(t, expectedCalls, calls)
+}
@@ -0,0 +1,125 @@
+package nsdns
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const ApiKeyEnvironmentVariable string = "NAMESILO_API_KEY"
+const DefaultApiKeyPollInterval time.Duration = 30 * time.Second
+
+// ApiKeyLoader fetches the current Namesilo API key from wherever it's
+// stored.
+type ApiKeyLoader func() (string, error)
+
+type SecretKeyReference struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// ParseSecretKeyReference parses references of the form namespace/name:key.
+func ParseSecretKeyReference(ref string) (*SecretKeyReference, error) {
+	namespacedName, key, ok := strings.Cut(ref, ":")
+	if !ok || key == "" {
+		return nil, fmt.Errorf("secret reference %q must be in the form namespace/name:key", ref)
+	}
+
+	namespace, name, ok := strings.Cut(namespacedName, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("secret reference %q must be in the form namespace/name:key", ref)
+	}
+
+	return &SecretKeyReference{namespace, name, key}, nil
+}
+
+func (s SecretKeyReference) String() string {
+	return fmt.Sprintf("%s/%s:%s", s.Namespace, s.Name, s.Key)
+}
+
+func ApiKeyFromEnvironment(name string) ApiKeyLoader {
+	return func() (string, error) {
+		apiKey := os.Getenv(name)
+		if apiKey == "" {
+			return "", fmt.Errorf("failed to find %s in environment; cannot proceed", name)
+		}
+
+		return apiKey, nil
+	}
+}
+
+func ApiKeyFromFile(path string) ApiKeyLoader {
+	return func() (string, error) {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		apiKey := strings.TrimSpace(string(contents))
+		if apiKey == "" {
+			return "", fmt.Errorf("api key file %s is empty", path)
+		}
+
+		return apiKey, nil
+	}
+}
+
+func ApiKeyFromSecret(clientset kubernetes.Interface, ref SecretKeyReference) ApiKeyLoader {
+	return func() (string, error) {
+		secret, err := clientset.CoreV1().Secrets(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return "", fmt.Errorf("secret %s/%s has no key %s", ref.Namespace, ref.Name, ref.Key)
+		}
+
+		apiKey := strings.TrimSpace(string(value))
+		if apiKey == "" {
+			return "", fmt.Errorf("secret key %s is empty", ref)
+		}
+
+		return apiKey, nil
+	}
+}
+
+// WatchApiKey polls the loader until stop is closed, calling onChange
+// whenever a key different from the previous one is found.
+// Failed loads are logged, and the last known key stays in use.
+func WatchApiKey(load ApiKeyLoader, current string, interval time.Duration, stop <-chan struct{}, onChange func(string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		apiKey, err := load()
+		if err != nil {
+			log.Errorf("Failed to reload Namesilo API key: %s", err.Error())
+			continue
+		}
+
+		if apiKey == current {
+			continue
+		}
+
+		log.Info("Namesilo API key changed; swapping credentials")
+		current = apiKey
+		onChange(apiKey)
+	}
+}
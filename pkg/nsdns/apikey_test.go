@@ -0,0 +1,116 @@
+package nsdns
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseSecretKeyReference(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected *SecretKeyReference
+	}{
+		{"Valid", "kube-system/namesilo:api-key", &SecretKeyReference{"kube-system", "namesilo", "api-key"}},
+		{"MissingKey", "kube-system/namesilo", nil},
+		{"EmptyKey", "kube-system/namesilo:", nil},
+		{"MissingNamespace", "namesilo:api-key", nil},
+		{"EmptyName", "kube-system/:api-key", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ParseSecretKeyReference(tt.input)
+			assert.Equal(t, tt.expected, ref)
+			if tt.expected == nil {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.input, ref.String())
+			}
+		})
+	}
+}
+
+func TestApiKeyFromFile(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "api-key")
+
+	load := ApiKeyFromFile(keyPath)
+	_, err := load()
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(keyPath, []byte("abc123\n"), 0600))
+	apiKey, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", apiKey)
+
+	assert.NoError(t, os.WriteFile(keyPath, []byte(""), 0600))
+	_, err = load()
+	assert.Equal(t, "api key file "+keyPath+" is empty", err.Error())
+}
+
+func TestApiKeyFromSecret(t *testing.T) {
+	secret := corev1.Secret{}
+	secret.Namespace = "kube-system"
+	secret.Name = "namesilo"
+	secret.Data = map[string][]byte{"api-key": []byte("abc123")}
+	clientset := fake.NewSimpleClientset(&secret)
+
+	apiKey, err := ApiKeyFromSecret(clientset, SecretKeyReference{"kube-system", "namesilo", "api-key"})()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", apiKey)
+
+	_, err = ApiKeyFromSecret(clientset, SecretKeyReference{"kube-system", "namesilo", "other"})()
+	assert.Equal(t, "secret kube-system/namesilo has no key other", err.Error())
+
+	_, err = ApiKeyFromSecret(clientset, SecretKeyReference{"default", "namesilo", "api-key"})()
+	assert.Error(t, err)
+
+	secret.Data["api-key"] = []byte("def456")
+	_, err = clientset.CoreV1().Secrets("kube-system").Update(context.TODO(), &secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	apiKey, err = ApiKeyFromSecret(clientset, SecretKeyReference{"kube-system", "namesilo", "api-key"})()
+	assert.NoError(t, err)
+	assert.Equal(t, "def456", apiKey)
+}
+
+func TestWatchApiKey(t *testing.T) {
+	keyPath := path.Join(t.TempDir(), "api-key")
+	assert.NoError(t, os.WriteFile(keyPath, []byte("abc123"), 0600))
+
+	changes := make(chan string, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go WatchApiKey(ApiKeyFromFile(keyPath), "abc123", time.Millisecond, stop, func(apiKey string) {
+		changes <- apiKey
+	})
+
+	assert.NoError(t, os.WriteFile(keyPath, []byte("def456"), 0600))
+
+	select {
+	case apiKey := <-changes:
+		assert.Equal(t, "def456", apiKey)
+	case <-time.After(time.Second):
+		t.Fatal("api key change was never observed")
+	}
+}
+
+func TestSetApiKey(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("a", "b", "c")
+	assert.NoError(t, err)
+	assert.NoError(t, dm.SetApiKey("d"))
+
+	dm.Api = &MockNamesiloApi{}
+	assert.Equal(t, "namesilo api client does not support changing api keys", dm.SetApiKey("d").Error())
+}
@@ -0,0 +1,221 @@
+package nsdns
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// fakeZone stands in for Namesilo, so that records added by one event are
+// visible to the next refresh.
+type fakeZone struct {
+	lock    sync.Mutex
+	records []namesilo_api.ResourceRecord
+	nextId  int
+	adds    int
+}
+
+func (z *fakeZone) ListDNSRecords() ([]namesilo_api.ResourceRecord, error) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	records := make([]namesilo_api.ResourceRecord, len(z.records))
+	copy(records, z.records)
+	return records, nil
+}
+
+func (z *fakeZone) UpdateDNSRecord(rr namesilo_api.ResourceRecord) error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	for i, r := range z.records {
+		if r.RecordId == rr.RecordId {
+			z.records[i] = rr
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no record with id %s", rr.RecordId)
+}
+
+func (z *fakeZone) AddDNSRecord(rr namesilo_api.ResourceRecord) error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	z.nextId++
+	z.adds++
+	rr.RecordId = fmt.Sprint(z.nextId)
+	z.records = append(z.records, rr)
+	return nil
+}
+
+func (z *fakeZone) DeleteDNSRecord(rr namesilo_api.ResourceRecord) error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	for i, r := range z.records {
+		if r.RecordId == rr.RecordId {
+			z.records = append(z.records[:i], z.records[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no record with id %s", rr.RecordId)
+}
+
+// testDnsManager returns a DnsManager for an empty zone, that's been synced
+// once. Tests set whatever else they need on it.
+func testDnsManager(t *testing.T) (*DnsManager, *fakeZone) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	zone := &fakeZone{}
+	dm.Api = zone
+	dm.RefreshesCacheOnUpdate = true
+	dm.publicIp = func() (string, error) { return "1.1.1.1", nil }
+
+	assert.NoError(t, dm.UpdateCache())
+	return dm, zone
+}
+
+func TestHandleIngressExistsConcurrentSameHost(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	ingress := ingressWithClass(dm, "sub.example.com")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, dm.HandleIngressExists(ingress))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, zone.adds)
+	assert.Len(t, zone.records, 1)
+}
+
+func TestDnsManagerConcurrentUse(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		ingress := ingressWithClass(dm, fmt.Sprintf("host%d.example.com", i))
+
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, dm.HandleIngressExists(ingress))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, dm.UpdateCache())
+		}()
+		go func() {
+			defer wg.Done()
+			dm.Status()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, zone.adds)
+
+	var deleted sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		ingress := ingressWithClass(dm, fmt.Sprintf("host%d.example.com", i))
+
+		deleted.Add(1)
+		go func() {
+			defer deleted.Done()
+			assert.NoError(t, dm.HandleIngressDeleted(ingress))
+		}()
+	}
+	deleted.Wait()
+
+	assert.Len(t, zone.records, 0)
+	assert.Equal(t, 0, dm.Status().RecordCount)
+}
+
+// stalledZone holds up the next list of records, once it's been read, until
+// release is closed.
+type stalledZone struct {
+	*fakeZone
+	listed  chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (z *stalledZone) ListDNSRecords() ([]namesilo_api.ResourceRecord, error) {
+	records, err := z.fakeZone.ListDNSRecords()
+
+	stalled := false
+	z.once.Do(func() { stalled = true })
+	if stalled {
+		close(z.listed)
+		<-z.release
+	}
+
+	return records, err
+}
+
+func TestUpdateCacheOverlapping(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	stalled := &stalledZone{fakeZone: zone, listed: make(chan struct{}), release: make(chan struct{})}
+	dm.Api = stalled
+
+	// The first refresh reads the zone before the ingress's record is added,
+	// and finishes after the refresh that follows the add.
+	first := make(chan error)
+	go func() {
+		first <- dm.UpdateCache()
+	}()
+	<-stalled.listed
+
+	ingress := ingressWithClass(dm, "sub.example.com")
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+
+	close(stalled.release)
+	assert.NoError(t, <-first)
+	assert.Len(t, dm.snapshot().CurrentRecords, 1)
+
+	// So the record is found, rather than added again.
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+	assert.Equal(t, 1, zone.adds)
+}
+
+func TestHostLocks(t *testing.T) {
+	locks := newHostLocks()
+
+	unlockA := locks.Lock("a.example.com")
+	unlockB := locks.Lock("b.example.com")
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock := locks.Lock("a.example.com")
+		close(acquired)
+		unlock()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired a lock that was already held")
+	default:
+	}
+
+	unlockB()
+	unlockA()
+	<-acquired
+
+	locks.lock.Lock()
+	defer locks.lock.Unlock()
+	assert.Len(t, locks.hosts, 0)
+}
@@ -0,0 +1,188 @@
+package nsdns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// ConflictPolicy decides what happens when a record can't be created because
+// of other records at the same name, since a CNAME can't share its name with
+// records of any other type.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyFail fails the Ingress, so that it's retried.
+	ConflictPolicyFail ConflictPolicy = "fail"
+	// ConflictPolicySkip leaves the other records alone, and doesn't create
+	// the record.
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// ConflictPolicyReplace deletes the other records if nsdns created them,
+	// and fails otherwise.
+	ConflictPolicyReplace ConflictPolicy = "replace"
+)
+
+var ConflictPolicies []ConflictPolicy = []ConflictPolicy{ConflictPolicyFail, ConflictPolicySkip, ConflictPolicyReplace}
+
+// ErrConflictingRecords is returned when a record can't be created without
+// removing records at the same name.
+var ErrConflictingRecords = errors.New("conflicting records")
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for _, p := range ConflictPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+
+	names := []string{}
+	for _, p := range ConflictPolicies {
+		names = append(names, string(p))
+	}
+
+	return "", fmt.Errorf("unsupported conflict policy %q; must be one of %s", s, strings.Join(names, ", "))
+}
+
+// conflictingRecords lists the records that can't exist at the same name as
+// record: everything else when it's a CNAME, or a CNAME when it isn't.
+func conflictingRecords(record *namesilo_api.ResourceRecord, records []namesilo_api.ResourceRecord) []namesilo_api.ResourceRecord {
+	rv := []namesilo_api.ResourceRecord{}
+	for _, r := range records {
+		if r.Type == record.Type || !record.SameHost(r) {
+			continue
+		}
+
+		if record.Type == namesilo_api.RecordTypeCNAME || r.Type == namesilo_api.RecordTypeCNAME {
+			rv = append(rv, r)
+		}
+	}
+
+	return rv
+}
+
+// managedRecords remembers the records nsdns has published for record
+// sources since it started. Namesilo doesn't keep track of who created
+// records, so these are the only ones the replace policy takes to be its own;
+// anything else at the name may have been made by hand.
+type managedRecords struct {
+	lock    sync.Mutex
+	records []namesilo_api.ResourceRecord
+}
+
+func newManagedRecords() *managedRecords {
+	return &managedRecords{records: []namesilo_api.ResourceRecord{}}
+}
+
+// add notes that rr was published, in place of old when it's given.
+func (m *managedRecords) add(rr namesilo_api.ResourceRecord, old *namesilo_api.ResourceRecord) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if old != nil {
+		m.removeLocked(*old)
+	}
+	m.removeLocked(rr)
+
+	// Record IDs aren't known until the cache is refreshed, so records are
+	// matched on everything else.
+	rr.RecordId = ""
+	m.records = append(m.records, rr)
+}
+
+func (m *managedRecords) remove(rr namesilo_api.ResourceRecord) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.removeLocked(rr)
+}
+
+func (m *managedRecords) removeLocked(rr namesilo_api.ResourceRecord) {
+	rr.RecordId = ""
+	for i, r := range m.records {
+		if r.EqualsRecord(rr) {
+			m.records = append(m.records[:i], m.records[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *managedRecords) contains(rr namesilo_api.ResourceRecord) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, r := range m.records {
+		if r.EqualsRecord(rr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func describeRecords(records []namesilo_api.ResourceRecord) string {
+	descriptions := []string{}
+	for _, r := range records {
+		descriptions = append(descriptions, describeRecord(&r))
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// resolveConflicts clears the way for record to be created, according to the
+// ConflictPolicy. It returns whether the record should be created.
+func (dm *DnsManager) resolveConflicts(object runtime.Object, record *namesilo_api.ResourceRecord, records []namesilo_api.ResourceRecord) (bool, error) {
+	conflicts := conflictingRecords(record, records)
+	if len(conflicts) == 0 {
+		return true, nil
+	}
+
+	message := fmt.Sprintf("record %s conflicts with existing records: %s", describeRecord(record), describeRecords(conflicts))
+	if dm.ConflictPolicy == ConflictPolicySkip {
+		log.Warnf("Not creating %s", message)
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionCreated, metrics.ReasonConflict).Inc()
+		dm.recordEvent(object, apicorev1.EventTypeWarning, ReasonRecordConflict, "Not creating %s", message)
+		return false, nil
+	}
+
+	// Failures are recorded as events by the caller.
+	if dm.ConflictPolicy != ConflictPolicyReplace {
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionCreated, metrics.ReasonConflict).Inc()
+		return false, fmt.Errorf("%w: %s", ErrConflictingRecords, message)
+	}
+
+	for _, r := range conflicts {
+		if !dm.managed.contains(r) {
+			metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionCreated, metrics.ReasonConflict).Inc()
+			return false, fmt.Errorf("%w: %s, and %s can't be replaced", ErrConflictingRecords, message, describeRecord(&r))
+		}
+	}
+
+	// The safeguards apply to replaced records like any others, and the record
+	// can only be created once all of them are gone.
+	log.Infof("Replacing %s", message)
+	for _, r := range conflicts {
+		deleted, err := dm.deleteRecord(object, r)
+		if err != nil {
+			return false, err
+		}
+
+		if !deleted {
+			metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionCreated, metrics.ReasonConflict).Inc()
+			return false, fmt.Errorf("%w: %s, and %s can't be deleted", ErrConflictingRecords, message, describeRecord(&r))
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,171 @@
+package nsdns
+
+import (
+	"errors"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, p := range ConflictPolicies {
+		parsed, err := ParseConflictPolicy(string(p))
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+
+	_, err := ParseConflictPolicy("ignore")
+	assert.Error(t, err)
+}
+
+func TestConflictingRecords(t *testing.T) {
+	records := []namesilo_api.ResourceRecord{
+		{Type: "A", Host: "sub.example.com", Value: "1.1.1.1"},
+		{Type: "TXT", Host: "sub.example.com", Value: "v=spf1 -all"},
+		{Type: "CNAME", Host: "cname.example.com", Value: "example.com"},
+		{Type: "TXT", Host: "cname.example.com", Value: "v=spf1 -all"},
+		{Type: "MX", Host: "other.example.com", Value: "mail.example.com"},
+	}
+
+	cname := &namesilo_api.ResourceRecord{Type: "CNAME", Host: "sub.example.com", Value: "example.com"}
+	assert.Equal(t, records[0:2], conflictingRecords(cname, records))
+
+	address := &namesilo_api.ResourceRecord{Type: "A", Host: "cname.example.com", Value: "1.1.1.1"}
+	assert.Equal(t, records[2:3], conflictingRecords(address, records))
+
+	address.Host = "sub.example.com"
+	assert.Len(t, conflictingRecords(address, records), 0)
+}
+
+func TestHandleIngressExistsConflicts(t *testing.T) {
+	var tests = []struct {
+		name     string
+		policy   ConflictPolicy
+		existing namesilo_api.ResourceRecord
+		expected []namesilo_api.ResourceRecord
+		fails    bool
+	}{
+		{
+			"Fail", ConflictPolicyFail,
+			namesilo_api.ResourceRecord{Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207},
+			[]namesilo_api.ResourceRecord{{RecordId: "1", Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207}},
+			true,
+		},
+		{
+			"Skip", ConflictPolicySkip,
+			namesilo_api.ResourceRecord{Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207},
+			[]namesilo_api.ResourceRecord{{RecordId: "1", Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207}},
+			false,
+		},
+		{
+			"ReplaceDefaultTTL", ConflictPolicyReplace,
+			namesilo_api.ResourceRecord{Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207},
+			[]namesilo_api.ResourceRecord{{RecordId: "1", Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207}},
+			true,
+		},
+		{
+			"ReplaceNotOwned", ConflictPolicyReplace,
+			namesilo_api.ResourceRecord{Type: "TXT", Host: "sub.example.com", Value: "v=spf1 -all", TTL: 7207},
+			[]namesilo_api.ResourceRecord{{RecordId: "1", Type: "TXT", Host: "sub.example.com", Value: "v=spf1 -all", TTL: 7207}},
+			true,
+		},
+		{
+			"ReplaceOtherTTL", ConflictPolicyReplace,
+			namesilo_api.ResourceRecord{Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 3600},
+			[]namesilo_api.ResourceRecord{{RecordId: "1", Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 3600}},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+			dm.ConflictPolicy = tt.policy
+
+			assert.NoError(t, zone.AddDNSRecord(tt.existing))
+			assert.NoError(t, dm.UpdateCache())
+
+			err := dm.HandleIngressExists(ingressWithClass(dm, "sub.example.com"))
+			if tt.fails {
+				assert.True(t, errors.Is(err, ErrConflictingRecords))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			records, _ := zone.ListDNSRecords()
+			assert.Equal(t, tt.expected, records)
+		})
+	}
+}
+
+func TestHandleIngressExistsReplacePublished(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.ConflictPolicy = ConflictPolicyReplace
+
+	ingress := ingressWithClass(dm, "sub.example.com")
+	ingress.Annotations[CNAMEFlatteningAnnotation] = "true"
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+
+	ingress.Annotations[CNAMEFlatteningAnnotation] = "false"
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Equal(t, []namesilo_api.ResourceRecord{{RecordId: "2", Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}}, records)
+}
+
+func TestHandleIngressExistsReplaceSafeguards(t *testing.T) {
+	existing := []namesilo_api.ResourceRecord{
+		{RecordId: "1", Type: "A", Host: "sub.example.com", Value: "2.2.2.2", TTL: 7207},
+		{RecordId: "2", Type: "AAAA", Host: "sub.example.com", Value: "::2", TTL: 7207},
+	}
+
+	var tests = []struct {
+		name      string
+		configure func(dm *DnsManager)
+		expected  []namesilo_api.ResourceRecord
+		err       error
+	}{
+		{
+			"UpsertOnly",
+			func(dm *DnsManager) { dm.Policy = PolicyUpsertOnly },
+			existing,
+			ErrConflictingRecords,
+		},
+		{
+			"Protected",
+			func(dm *DnsManager) { assert.NoError(t, dm.SetProtectedHosts([]string{"sub"})) },
+			existing,
+			ErrConflictingRecords,
+		},
+		{
+			"MaxDeletes",
+			func(dm *DnsManager) { dm.MaxDeletesPerSync = 1 },
+			existing[1:],
+			ErrTooManyDeletes,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+			dm.ConflictPolicy = ConflictPolicyReplace
+			tt.configure(dm)
+
+			for _, r := range existing {
+				assert.NoError(t, zone.AddDNSRecord(r))
+				dm.managed.add(r, nil)
+			}
+			assert.NoError(t, dm.UpdateCache())
+
+			err := dm.HandleIngressExists(ingressWithClass(dm, "sub.example.com"))
+			assert.True(t, errors.Is(err, tt.err))
+
+			records, _ := zone.ListDNSRecords()
+			assert.Equal(t, tt.expected, records)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package nsdns
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// recordContributors tracks which Ingresses want a record for each hostname,
+// so that a record shared by several is only deleted along with the last of
+// them. When they want different records, the first to ask for one wins.
+type recordContributors struct {
+	lock   sync.Mutex
+	hosts  map[string]*recordClaims
+	hostOf map[string]string
+}
+
+func newRecordContributors() *recordContributors {
+	return &recordContributors{
+		hosts:  map[string]*recordClaims{},
+		hostOf: map[string]string{},
+	}
+}
+
+// add records that the Ingress with key wants record, and returns the
+// Ingress that got there first, if it wants something else.
+func (c *recordContributors) add(key string, record namesilo_api.ResourceRecord) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if host, ok := c.hostOf[key]; ok && host != record.Host {
+		c.removeLocked(key, host)
+	}
+
+	contributors, ok := c.hosts[record.Host]
+	if !ok {
+		contributors = newRecordClaims()
+		c.hosts[record.Host] = contributors
+	}
+
+	contributors.add(key, record)
+	c.hostOf[key] = record.Host
+
+	owner := contributors.owner()
+	if owner != key && !contributors.claims[owner].record.EqualsRecord(record) {
+		return owner, true
+	}
+
+	return "", false
+}
+
+// addressHosts lists the hostnames whose records point at the public IP.
+func (c *recordContributors) addressHosts() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	rv := []string{}
+	for host, contributors := range c.hosts {
+		// Records that point at some other address are tracked with it.
+		record := contributors.claims[contributors.owner()].record
+		if isAddressRecord(record) && record.Value == "" {
+			rv = append(rv, host)
+		}
+	}
+
+	sort.Strings(rv)
+	return rv
+}
+
+// recordAt returns the record wanted for host, and the key of whoever got
+// there first.
+func (c *recordContributors) recordAt(host string) (string, namesilo_api.ResourceRecord, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	contributors, ok := c.hosts[host]
+	if !ok {
+		return "", namesilo_api.ResourceRecord{}, false
+	}
+
+	owner := contributors.owner()
+	return owner, contributors.claims[owner].record, true
+}
+
+// remove forgets that the Ingress with key wants a record for host, and
+// returns the Ingresses that still do.
+func (c *recordContributors) remove(key, host string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeLocked(key, host)
+
+	rv := []string{}
+	if contributors, ok := c.hosts[host]; ok {
+		for k := range contributors.claims {
+			rv = append(rv, k)
+		}
+	}
+
+	sort.Strings(rv)
+	return rv
+}
+
+// forget drops the Ingress with key from whichever hostname it wanted.
+func (c *recordContributors) forget(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if host, ok := c.hostOf[key]; ok {
+		c.removeLocked(key, host)
+	}
+}
+
+// retain forgets the keys starting with prefix, other than the ones in keep,
+// and returns the records they wanted.
+func (c *recordContributors) retain(prefix string, keep map[string]bool) map[string]namesilo_api.ResourceRecord {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	rv := map[string]namesilo_api.ResourceRecord{}
+	for key, host := range c.hostOf {
+		if strings.HasPrefix(key, prefix) && !keep[key] {
+			rv[key] = c.hosts[host].claims[key].record
+			c.removeLocked(key, host)
+		}
+	}
+
+	return rv
+}
+
+func (c *recordContributors) removeLocked(key, host string) {
+	if contributors, ok := c.hosts[host]; ok {
+		contributors.remove(key)
+		if len(contributors.claims) == 0 {
+			delete(c.hosts, host)
+		}
+	}
+
+	if c.hostOf[key] == host {
+		delete(c.hostOf, key)
+	}
+}
+
+// recordClaims holds the records that several keys want, in the order they
+// first asked for them, so that the oldest can win when they disagree. It's
+// guarded by the lock of whatever holds it.
+type recordClaims struct {
+	claims map[string]claim
+	next   int
+}
+
+type claim struct {
+	record namesilo_api.ResourceRecord
+	order  int
+}
+
+func newRecordClaims() *recordClaims {
+	return &recordClaims{claims: map[string]claim{}}
+}
+
+// add records that key wants record, keeping its place if it already wanted
+// something.
+func (c *recordClaims) add(key string, record namesilo_api.ResourceRecord) {
+	existing, ok := c.claims[key]
+	if !ok {
+		existing.order = c.next
+		c.next++
+	}
+	c.claims[key] = claim{record, existing.order}
+}
+
+func (c *recordClaims) remove(key string) {
+	delete(c.claims, key)
+}
+
+// owner returns the key that asked for a record first.
+func (c *recordClaims) owner() string {
+	return c.oldest(func(string, claim) bool { return true })
+}
+
+// oldest returns the key that asked first among the claims that match.
+func (c *recordClaims) oldest(match func(key string, other claim) bool) string {
+	owner := ""
+	for k, other := range c.claims {
+		if !match(k, other) {
+			continue
+		}
+
+		if owner == "" || other.order < c.claims[owner].order {
+			owner = k
+		}
+	}
+
+	return owner
+}
@@ -0,0 +1,143 @@
+package nsdns
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func cnameRecord(host, value string) namesilo_api.ResourceRecord {
+	return namesilo_api.ResourceRecord{Type: namesilo_api.RecordTypeCNAME, Host: host, Value: value, TTL: namesilo_api.DefaultTTL}
+}
+
+func TestRecordContributors(t *testing.T) {
+	c := newRecordContributors()
+
+	_, conflict := c.add("default/a", cnameRecord("sub.example.com", "example.com"))
+	assert.False(t, conflict)
+	_, conflict = c.add("other/b", cnameRecord("sub.example.com", "example.com"))
+	assert.False(t, conflict)
+
+	owner, conflict := c.add("other/c", cnameRecord("sub.example.com", "elsewhere.com"))
+	assert.True(t, conflict)
+	assert.Equal(t, "default/a", owner)
+
+	// Adding again keeps the original order.
+	_, conflict = c.add("default/a", cnameRecord("sub.example.com", "example.com"))
+	assert.False(t, conflict)
+
+	assert.Equal(t, []string{"other/b", "other/c"}, c.remove("default/a", "sub.example.com"))
+
+	// b is now the first, so c still conflicts with it.
+	owner, conflict = c.add("other/c", cnameRecord("sub.example.com", "elsewhere.com"))
+	assert.True(t, conflict)
+	assert.Equal(t, "other/b", owner)
+
+	assert.Equal(t, []string{"other/c"}, c.remove("other/b", "sub.example.com"))
+
+	_, conflict = c.add("other/c", cnameRecord("sub.example.com", "elsewhere.com"))
+	assert.False(t, conflict)
+	assert.Equal(t, []string{}, c.remove("other/c", "sub.example.com"))
+	assert.Len(t, c.hosts, 0)
+	assert.Len(t, c.hostOf, 0)
+}
+
+func TestRecordContributorsHostChange(t *testing.T) {
+	c := newRecordContributors()
+
+	c.add("default/a", cnameRecord("old.example.com", "example.com"))
+	c.add("default/b", cnameRecord("old.example.com", "example.com"))
+	c.add("default/a", cnameRecord("new.example.com", "example.com"))
+
+	assert.Equal(t, []string{}, c.remove("default/b", "old.example.com"))
+
+	c.forget("default/a")
+	assert.Len(t, c.hosts, 0)
+	assert.Len(t, c.hostOf, 0)
+}
+
+func namedIngress(dm *DnsManager, namespace, name, host string) *apinetworkingv1.Ingress {
+	ingress := ingressWithClass(dm, host)
+	ingress.Namespace = namespace
+	ingress.Name = name
+	return ingress
+}
+
+func TestHandleIngressDeletedSharedHost(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+
+	rr := namesilo_api.ResourceRecord{RecordId: "1234", Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, rr)
+
+	a := namedIngress(dm, "team-a", "web", "sub.example.com")
+	b := namedIngress(dm, "team-b", "api", "sub.example.com")
+	assert.NoError(t, dm.HandleIngressExists(a))
+	assert.NoError(t, dm.HandleIngressExists(b))
+
+	// b still needs the record.
+	assert.NoError(t, dm.HandleIngressDeleted(a))
+	nsapi.AssertExpectations(t)
+
+	nsapi.On("DeleteDNSRecord", rr).Return(nil).Once()
+	assert.NoError(t, dm.HandleIngressDeleted(b))
+	nsapi.AssertExpectations(t)
+}
+
+func TestTrackIngresses(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+
+	rr := namesilo_api.ResourceRecord{RecordId: "1234", Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, rr)
+
+	newer := namedIngress(dm, "team-a", "web", "sub.example.com")
+	newer.CreationTimestamp = metav1.Now()
+	older := namedIngress(dm, "team-b", "api", "sub.example.com")
+	older.CreationTimestamp = metav1.NewTime(newer.CreationTimestamp.Add(-1))
+	unmanaged := ingressWithHost("sub.example.com")
+	unmanaged.Name = "other"
+
+	dm.TrackIngresses([]*apinetworkingv1.Ingress{newer, older, unmanaged})
+
+	owner, conflict := dm.contributors.add("team-c/other", cnameRecord("sub.example.com", "elsewhere.com"))
+	assert.True(t, conflict)
+	assert.Equal(t, "team-b/api", owner)
+
+	// Neither was handled yet, but deleting one leaves the record for the
+	// other.
+	assert.NoError(t, dm.HandleIngressDeleted(newer))
+	nsapi.AssertExpectations(t)
+	nsapi.AssertNotCalled(t, "DeleteDNSRecord", mock.Anything)
+}
+
+func TestHandleIngressExistsConflict(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+
+	dm.contributors.add("team-a/web", cnameRecord("sub.example.com", "elsewhere.com"))
+
+	err = dm.HandleIngressExists(namedIngress(dm, "team-b", "api", "sub.example.com"))
+	assert.ErrorIs(t, err, ErrRecordConflict)
+	assert.Equal(t, "conflicting record: ingress team-b/api wants CNAME:sub.example.com, but ingress team-a/web already has a different record there", err.Error())
+
+	nsapi.AssertExpectations(t)
+}
@@ -0,0 +1,240 @@
+package nsdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	networkinginformers "k8s.io/client-go/informers/networking/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const DefaultMaxRetries int = 10
+const DefaultRetryBaseDelay time.Duration = 1 * time.Second
+const DefaultRetryMaxDelay time.Duration = 5 * time.Minute
+
+// IngressController queues Ingress events by namespace/name, and hands them to
+// a DnsManager from a pool of workers. Keys that fail are retried with
+// exponential backoff, up to MaxRetries times.
+type IngressController struct {
+	*retryQueue
+
+	dm       *DnsManager
+	informer cache.SharedIndexInformer
+	lister   networkinglisters.IngressLister
+
+	// With AddsFinalizer, managed Ingresses get the CleanupFinalizer, so that
+	// their records are removed even if they're deleted while nsdns isn't
+	// running. Finalizers is needed to add it, and to remove it again.
+	Finalizers    IngressFinalizerSetter
+	AddsFinalizer bool
+
+	lastSeen *lastSeenObjects
+
+	// Ingresses whose records were removed before they were deleted, so there's
+	// nothing left to do once their deletion comes through.
+	finalizedLock sync.Mutex
+	finalized     map[string]bool
+}
+
+func NewIngressController(dm *DnsManager, informer networkinginformers.IngressInformer) *IngressController {
+	rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(DefaultRetryBaseDelay, DefaultRetryMaxDelay)
+	return newIngressController(dm, informer, rateLimiter)
+}
+
+func newIngressController(dm *DnsManager, informer networkinginformers.IngressInformer, rateLimiter workqueue.RateLimiter) *IngressController {
+	c := &IngressController{
+		dm:        dm,
+		informer:  informer.Informer(),
+		lister:    informer.Lister(),
+		lastSeen:  newLastSeenObjects(),
+		finalized: map[string]bool{},
+	}
+	c.retryQueue = newRetryQueue("ingress", "ingresses", rateLimiter, c.sync)
+	return c
+}
+
+// Run handles events until ctx is cancelled. The informer must already have
+// synced; every Ingress it holds is queued when Run starts.
+// Once ctx is cancelled, Run waits for each worker to finish the Ingress it's
+// working on, and logs the ones that were still waiting.
+func (c *IngressController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+
+	registration, err := c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			c.enqueue(new)
+		},
+		DeleteFunc: c.enqueueDeleted,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.informer.RemoveEventHandler(registration)
+
+	ingresses, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	c.dm.TrackIngresses(ingresses)
+
+	c.run(ctx, workers)
+	return nil
+}
+
+func (c *IngressController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.add(key)
+}
+
+func (c *IngressController) enqueueDeleted(obj interface{}) {
+	key, err := c.lastSeen.observe(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.add(key)
+}
+
+func (c *IngressController) sync(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	ingress, err := c.lister.Ingresses(namespace).Get(name)
+	if err == nil {
+		if ingress.DeletionTimestamp != nil {
+			return c.finalize(key, ingress)
+		}
+
+		c.lastSeen.set(key, ingress)
+		c.setFinalized(key, false)
+		if err := c.syncFinalizer(ingress); err != nil {
+			return err
+		}
+
+		return c.dm.HandleIngressExists(ingress)
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get ingress %s: %w", key, err)
+	}
+
+	if c.forgetFinalized(key) {
+		log.Debugf("Ingress %s was deleted after its records were removed", key)
+		c.lastSeen.forget(key)
+		return nil
+	}
+
+	return c.lastSeen.deleted(key, func(obj runtime.Object) error {
+		ingress, ok := obj.(*apinetworkingv1.Ingress)
+		if !ok {
+			return fmt.Errorf("unexpected ingress object %T", obj)
+		}
+
+		return c.deleteRecords(ingress)
+	})
+}
+
+// finalize removes the records of an Ingress that's being deleted, and then
+// lets the deletion go ahead.
+func (c *IngressController) finalize(key string, ingress *apinetworkingv1.Ingress) error {
+	if !hasFinalizer(ingress.Finalizers, CleanupFinalizer) {
+		return nil
+	}
+
+	if err := c.deleteRecords(ingress); err != nil {
+		return err
+	}
+
+	if c.Finalizers == nil {
+		return fmt.Errorf("cannot remove finalizer %s from ingress %s", CleanupFinalizer, key)
+	}
+
+	log.Debugf("Removing finalizer %s from ingress %s", CleanupFinalizer, key)
+	err := c.Finalizers(ingress, withoutFinalizer(ingress.Finalizers, CleanupFinalizer))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	c.setFinalized(key, true)
+	return nil
+}
+
+// syncFinalizer adds the finalizer to Ingresses that are managed, and removes
+// it from ones that no longer are, so that their deletion isn't held up.
+func (c *IngressController) syncFinalizer(ingress *apinetworkingv1.Ingress) error {
+	if c.Finalizers == nil {
+		return nil
+	}
+
+	managed := c.AddsFinalizer && c.dm.ShouldProcessIngress(ingress)
+	if managed == hasFinalizer(ingress.Finalizers, CleanupFinalizer) {
+		return nil
+	}
+
+	if managed {
+		log.Debugf("Adding finalizer %s to ingress %s/%s", CleanupFinalizer, ingress.Namespace, ingress.Name)
+		return c.Finalizers(ingress, append(withoutFinalizer(ingress.Finalizers, CleanupFinalizer), CleanupFinalizer))
+	}
+
+	log.Debugf("Removing finalizer %s from ingress %s/%s", CleanupFinalizer, ingress.Namespace, ingress.Name)
+	return c.Finalizers(ingress, withoutFinalizer(ingress.Finalizers, CleanupFinalizer))
+}
+
+// deleteRecords treats records that are already gone as deleted, since
+// retrying won't bring them back.
+func (c *IngressController) deleteRecords(ingress *apinetworkingv1.Ingress) error {
+	err := c.dm.HandleIngressDeleted(ingress)
+	if errors.Is(err, ErrRecordNotFound) {
+		log.Debugf("Record of ingress %s/%s is already gone", ingress.Namespace, ingress.Name)
+		return nil
+	}
+
+	return err
+}
+
+func (c *IngressController) setFinalized(key string, finalized bool) {
+	c.finalizedLock.Lock()
+	defer c.finalizedLock.Unlock()
+
+	if finalized {
+		c.finalized[key] = true
+	} else {
+		delete(c.finalized, key)
+	}
+}
+
+// forgetFinalized returns whether a deleted Ingress was already finalized, in
+// which case it's forgotten.
+func (c *IngressController) forgetFinalized(key string) bool {
+	c.finalizedLock.Lock()
+	defer c.finalizedLock.Unlock()
+
+	if !c.finalized[key] {
+		return false
+	}
+
+	delete(c.finalized, key)
+	return true
+}
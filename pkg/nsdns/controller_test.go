@@ -0,0 +1,294 @@
+package nsdns
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func runTestIngressController(dm *DnsManager, clientset *fake.Clientset, maxRetries int) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	informer := factory.Networking().V1().Ingresses()
+	controller := newIngressController(dm, informer, workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+	controller.MaxRetries = maxRetries
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	go controller.Run(ctx, 2)
+	return cancel
+}
+
+func TestIngressControllerRetries(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	var calls int32
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	countCall := func(mock.Arguments) { atomic.AddInt32(&calls, 1) }
+	nsapi.On("AddDNSRecord", mock.Anything).Return(errors.New("namesilo is down")).Twice().Run(countCall)
+	nsapi.On("AddDNSRecord", mock.Anything).Return(nil).Once().Run(countCall)
+
+	ingress := ingressWithClass(dm, "example.com")
+	ingress.Name = "web"
+	ingress.Namespace = "default"
+	clientset := fake.NewSimpleClientset(ingress)
+
+	cancel := runTestIngressController(dm, clientset, DefaultMaxRetries)
+	defer cancel()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 3 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	nsapi.AssertExpectations(t)
+}
+
+func TestIngressControllerGivesUp(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	var calls int32
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	nsapi.On("AddDNSRecord", mock.Anything).Return(errors.New("namesilo is down")).Run(func(mock.Arguments) {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	ingress := ingressWithClass(dm, "example.com")
+	ingress.Name = "web"
+	ingress.Namespace = "default"
+	clientset := fake.NewSimpleClientset(ingress)
+
+	cancel := runTestIngressController(dm, clientset, 3)
+	defer cancel()
+
+	// The first attempt, and three retries.
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 4 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestIngressControllerDelete(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	rr := namesilo_api.ResourceRecord{
+		RecordId: "1234",
+		Type:     "A",
+		Host:     "example.com",
+		Value:    "1.1.1.1",
+		TTL:      7207,
+	}
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, rr)
+
+	deleted := make(chan struct{})
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	nsapi.On("DeleteDNSRecord", rr).Return(nil).Once().Run(func(mock.Arguments) {
+		close(deleted)
+	})
+
+	ingress := ingressWithClass(dm, "example.com")
+	ingress.Name = "web"
+	ingress.Namespace = "default"
+	clientset := fake.NewSimpleClientset(ingress)
+
+	cancel := runTestIngressController(dm, clientset, DefaultMaxRetries)
+	defer cancel()
+
+	// Let the existing Ingress be processed; its record is already up to
+	// date, so nothing is called.
+	time.Sleep(50 * time.Millisecond)
+
+	err = clientset.NetworkingV1().Ingresses("default").Delete(context.Background(), "web", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	select {
+	case <-deleted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("record was never deleted")
+	}
+
+	nsapi.AssertExpectations(t)
+}
+
+func TestIngressControllerShutdown(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	nsapi.On("AddDNSRecord", mock.Anything).Return(nil).Run(func(mock.Arguments) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+		}
+	})
+
+	a := ingressWithClass(dm, "a.example.com")
+	a.Name, a.Namespace = "a", "default"
+	b := ingressWithClass(dm, "b.example.com")
+	b.Name, b.Namespace = "b", "default"
+	clientset := fake.NewSimpleClientset(a, b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	informer := factory.Networking().V1().Ingresses()
+	controller := NewIngressController(dm, informer)
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, controller.Run(ctx, 1))
+		close(done)
+	}()
+
+	<-started
+	// The informer hands over the other ingress in its own time, and it's only
+	// abandoned if it was queued.
+	assert.Eventually(t, func() bool { return controller.queue.Len() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	assert.Len(t, controller.InFlight(), 1)
+	select {
+	case <-done:
+		t.Fatal("stopped without finishing the ingress in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-done
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Len(t, controller.InFlight(), 0)
+	assert.Contains(t, hook.LastEntry().Message, "Abandoned 1 pending ingresses: default/")
+}
+
+func TestIngressControllerAddsFinalizer(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	nsapi.On("AddDNSRecord", mock.Anything).Return(nil)
+
+	managed := ingressWithClass(dm, "example.com")
+	managed.Name, managed.Namespace = "managed", "default"
+	unmanaged := ingressWithHost("other.example.com")
+	unmanaged.Name, unmanaged.Namespace = "unmanaged", "default"
+	unmanaged.Finalizers = []string{"example.com/other", CleanupFinalizer}
+	clientset := fake.NewSimpleClientset(managed, unmanaged)
+
+	controller := NewIngressController(dm, informers.NewSharedInformerFactory(clientset, 0).Networking().V1().Ingresses())
+	controller.Finalizers = NewIngressFinalizerSetter(clientset)
+	controller.AddsFinalizer = true
+
+	assert.NoError(t, controller.syncFinalizer(managed))
+	assert.NoError(t, controller.syncFinalizer(unmanaged))
+
+	ingress, err := clientset.NetworkingV1().Ingresses("default").Get(context.Background(), "managed", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{CleanupFinalizer}, ingress.Finalizers)
+
+	ingress, err = clientset.NetworkingV1().Ingresses("default").Get(context.Background(), "unmanaged", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com/other"}, ingress.Finalizers)
+}
+
+func TestIngressControllerFinalizes(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	rr := namesilo_api.ResourceRecord{
+		RecordId: "1234",
+		Type:     "A",
+		Host:     "example.com",
+		Value:    "1.1.1.1",
+		TTL:      7207,
+	}
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, rr)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	nsapi.On("DeleteDNSRecord", rr).Return(nil).Once()
+
+	now := metav1.Now()
+	ingress := ingressWithClass(dm, "example.com")
+	ingress.Name, ingress.Namespace = "web", "default"
+	ingress.Finalizers = []string{CleanupFinalizer}
+	ingress.DeletionTimestamp = &now
+	clientset := fake.NewSimpleClientset(ingress)
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	controller := NewIngressController(dm, factory.Networking().V1().Ingresses())
+	controller.Finalizers = NewIngressFinalizerSetter(clientset)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	assert.NoError(t, controller.sync("default/web"))
+
+	patched, err := clientset.NetworkingV1().Ingresses("default").Get(context.Background(), "web", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, patched.Finalizers)
+
+	// Once the deletion comes through, there's nothing left to delete.
+	assert.NoError(t, clientset.NetworkingV1().Ingresses("default").Delete(context.Background(), "web", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		_, err := controller.lister.Ingresses("default").Get("web")
+		return err != nil
+	}, time.Second, time.Millisecond)
+
+	controller.enqueueDeleted(ingress)
+	assert.NoError(t, controller.sync("default/web"))
+
+	nsapi.AssertExpectations(t)
+}
+
+func TestIngressControllerTombstone(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	ingress := ingressWithClass(dm, "example.com")
+	ingress.Name, ingress.Namespace = "web", "default"
+
+	controller := NewIngressController(dm, informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Networking().V1().Ingresses())
+	controller.enqueueDeleted(cache.DeletedFinalStateUnknown{Key: "default/web", Obj: ingress})
+
+	assert.Equal(t, 1, controller.queue.Len())
+	assert.Equal(t, ingress, controller.lastSeen.objects["default/web"])
+}
@@ -0,0 +1,248 @@
+package nsdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// DNSRecordController reconciles DNSRecords, read through a dynamic
+// informer, and writes the result to their status. DNSRecords get the
+// CleanupFinalizer, so that their records are deleted along with them.
+type DNSRecordController struct {
+	*retryQueue
+
+	dm       *DnsManager
+	client   dynamic.NamespaceableResourceInterface
+	informer cache.SharedIndexInformer
+	lister   cache.GenericLister
+}
+
+func NewDNSRecordController(dm *DnsManager, client dynamic.Interface, informer informers.GenericInformer) *DNSRecordController {
+	rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(DefaultRetryBaseDelay, DefaultRetryMaxDelay)
+	return newDNSRecordController(dm, client, informer, rateLimiter)
+}
+
+func newDNSRecordController(dm *DnsManager, client dynamic.Interface, informer informers.GenericInformer, rateLimiter workqueue.RateLimiter) *DNSRecordController {
+	c := &DNSRecordController{
+		dm:       dm,
+		client:   client.Resource(DNSRecordResource),
+		informer: informer.Informer(),
+		lister:   informer.Lister(),
+	}
+	c.retryQueue = newRetryQueue("dnsrecord", "dnsrecords", rateLimiter, c.sync)
+	return c
+}
+
+// Run handles events until ctx is cancelled, like IngressController.Run.
+func (c *DNSRecordController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+
+	registration, err := c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			c.enqueue(new)
+		},
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.informer.RemoveEventHandler(registration)
+
+	objs, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	records := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		if record, ok := obj.(*unstructured.Unstructured); ok {
+			records = append(records, record)
+		}
+	}
+	c.dm.TrackDNSRecords(records)
+
+	c.run(ctx, workers)
+	return nil
+}
+
+func (c *DNSRecordController) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.add(key)
+}
+
+func (c *DNSRecordController) sync(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	obj, err := c.lister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		// Its finalizer was removed by something else, so whatever became of
+		// its record is out of nsdns's hands.
+		c.dm.ForgetDNSRecord(namespace, name)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get dnsrecord %s: %w", key, err)
+	}
+
+	record, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected dnsrecord object %T", obj)
+	}
+	record = record.DeepCopy()
+
+	if record.GetDeletionTimestamp() != nil {
+		return c.finalize(record)
+	}
+
+	if !hasFinalizer(record.GetFinalizers(), CleanupFinalizer) {
+		log.Debugf("Adding finalizer %s to dnsrecord %s", CleanupFinalizer, key)
+		record.SetFinalizers(append(record.GetFinalizers(), CleanupFinalizer))
+		record, err = c.client.Namespace(namespace).Update(context.TODO(), record, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	record, err = c.markPending(record)
+	if err != nil {
+		return err
+	}
+
+	owned, err := c.dm.HandleDNSRecordExists(record)
+	if statusErr := c.updateStatus(record, owned, err); statusErr != nil {
+		log.Errorf("Failed to update the status of dnsrecord %s: %s", key, statusErr.Error())
+		if err == nil {
+			err = statusErr
+		}
+	}
+
+	// Blocked changes stay that way until the safeguards change, which takes
+	// a restart.
+	if errors.Is(err, ErrRecordBlocked) {
+		log.Warn(err)
+		return nil
+	}
+
+	return err
+}
+
+// finalize deletes the record of a DNSRecord that's being deleted, and then
+// lets the deletion go ahead.
+func (c *DNSRecordController) finalize(record *unstructured.Unstructured) error {
+	if !hasFinalizer(record.GetFinalizers(), CleanupFinalizer) {
+		return nil
+	}
+
+	if err := c.dm.HandleDNSRecordDeleted(record); err != nil {
+		return err
+	}
+
+	log.Debugf("Removing finalizer %s from dnsrecord %s/%s", CleanupFinalizer, record.GetNamespace(), record.GetName())
+	record.SetFinalizers(withoutFinalizer(record.GetFinalizers(), CleanupFinalizer))
+	_, err := c.client.Namespace(record.GetNamespace()).Update(context.TODO(), record, metav1.UpdateOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// markPending writes the record a DNSRecord asks for to its status as
+// pending before it's published, unless it's already owned or pending.
+// Invalid specs are left to be reported by HandleDNSRecordExists.
+func (c *DNSRecordController) markPending(record *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	dr, err := DNSRecordFromUnstructured(record)
+	if err != nil {
+		return record, nil
+	}
+
+	rr, err := dr.Spec.resourceRecord(c.dm.BareDomainName)
+	if err != nil {
+		return record, nil
+	}
+
+	for _, r := range []*namesilo_api.ResourceRecord{dr.ownedRecord(), dr.pendingRecord()} {
+		if r != nil && r.EqualsRecord(rr) {
+			return record, nil
+		}
+	}
+
+	status := dr.Status
+	status.PendingRecord = specFromRecord(rr)
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unstructured.SetNestedField(record.Object, obj, "status"); err != nil {
+		return nil, err
+	}
+
+	return c.client.Namespace(record.GetNamespace()).UpdateStatus(context.TODO(), record, metav1.UpdateOptions{})
+}
+
+// updateStatus writes the record a DNSRecord owns, and the result of
+// handling it, to its status, unless nothing changed.
+func (c *DNSRecordController) updateStatus(record *unstructured.Unstructured, owned *namesilo_api.ResourceRecord, err error) error {
+	dr, convertErr := DNSRecordFromUnstructured(record)
+	if convertErr != nil {
+		return convertErr
+	}
+
+	status := DNSRecordStatus{ObservedGeneration: record.GetGeneration()}
+	if owned != nil {
+		status.Record = specFromRecord(*owned)
+	}
+
+	// A pending record that wasn't published may still have been created.
+	if pending := dr.pendingRecord(); pending != nil && (owned == nil || !pending.EqualsRecord(*owned)) {
+		status.PendingRecord = dr.Status.PendingRecord
+	}
+	status.Conditions = dnsRecordConditions(dr.Status.Conditions, record.GetGeneration(), err)
+
+	if equality.Semantic.DeepEqual(dr.Status, status) {
+		return nil
+	}
+
+	obj, convertErr := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if convertErr != nil {
+		return convertErr
+	}
+
+	if err := unstructured.SetNestedField(record.Object, obj, "status"); err != nil {
+		return err
+	}
+
+	_, updateErr := c.client.Namespace(record.GetNamespace()).UpdateStatus(context.TODO(), record, metav1.UpdateOptions{})
+	return updateErr
+}
@@ -0,0 +1,512 @@
+package nsdns
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+const DNSRecordGroup string = "nsdns.io"
+
+var DNSRecordResource = schema.GroupVersionResource{Group: DNSRecordGroup, Version: "v1alpha1", Resource: "dnsrecords"}
+
+const dnsRecordKind string = "DNSRecord"
+
+// Condition types set on DNSRecords.
+const (
+	// DNSRecordReady is True once the record asked for is published.
+	DNSRecordReady string = "Ready"
+	// DNSRecordConflict is True when something else already has the record,
+	// or has records at its name that it can't share it with.
+	DNSRecordConflict string = "Conflict"
+	// DNSRecordError is True when the record is invalid, or couldn't be
+	// changed.
+	DNSRecordError string = "Error"
+)
+
+// DNSRecord asks for a record that has nothing to do with any Ingress, like a
+// TXT record for domain verification, or an MX record.
+type DNSRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSRecordSpec   `json:"spec"`
+	Status DNSRecordStatus `json:"status,omitempty"`
+}
+
+// DNSRecordSpec takes a host relative to the domain, like _dmarc, or fully
+// qualified within it; an empty host, or @, is the domain itself. Priority is
+// the preference of MX records and the priority of SRV records. A TTL of 0
+// uses Namesilo's default.
+type DNSRecordSpec struct {
+	Type     string `json:"type"`
+	Host     string `json:"host,omitempty"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+type DNSRecordStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Record is the record last published for the DNSRecord, with its host
+	// fully qualified. It's the record the DNSRecord owns, which is changed
+	// along with it, and deleted when it is.
+	Record *DNSRecordSpec `json:"record,omitempty"`
+
+	// PendingRecord is the record being published, written before it's
+	// created. A record that's already there is only taken over when it was
+	// pending, since otherwise it may have been made by hand.
+	PendingRecord *DNSRecordSpec `json:"pendingRecord,omitempty"`
+
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+func DNSRecordFromUnstructured(obj *unstructured.Unstructured) (*DNSRecord, error) {
+	dr := &DNSRecord{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, dr); err != nil {
+		return nil, fmt.Errorf("invalid %s %s/%s: %w", dnsRecordKind, obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	return dr, nil
+}
+
+func dnsRecordKey(obj metav1.Object) string {
+	return objectKey(dnsRecordKind, obj)
+}
+
+// resourceRecord validates the spec, and builds the record it asks for.
+func (s DNSRecordSpec) resourceRecord(domainName string) (namesilo_api.ResourceRecord, error) {
+	rt, err := namesilo_api.ParseRecordType(s.Type)
+	if err != nil {
+		return namesilo_api.ResourceRecord{}, err
+	}
+
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = namesilo_api.DefaultTTL
+	}
+
+	rr := namesilo_api.ResourceRecord{Type: rt, Host: s.Host, Value: s.Value, TTL: ttl, Distance: s.Priority}
+	rr, err = rr.Canonical(domainName)
+	if err != nil {
+		return rr, err
+	}
+
+	return rr, rr.Validate()
+}
+
+func specFromRecord(rr namesilo_api.ResourceRecord) *DNSRecordSpec {
+	return &DNSRecordSpec{Type: rr.Type.String(), Host: rr.Host, Value: rr.Value, TTL: rr.TTL, Priority: rr.Distance}
+}
+
+// ownedRecord is the record in the DNSRecord's status, if it has one.
+func (dr *DNSRecord) ownedRecord() *namesilo_api.ResourceRecord {
+	return recordFromSpec(dr.Status.Record)
+}
+
+// pendingRecord is the record the DNSRecord's status says is being
+// published, if any.
+func (dr *DNSRecord) pendingRecord() *namesilo_api.ResourceRecord {
+	return recordFromSpec(dr.Status.PendingRecord)
+}
+
+// recordFromSpec takes a spec from a status, whose host is already fully
+// qualified.
+func recordFromSpec(s *DNSRecordSpec) *namesilo_api.ResourceRecord {
+	if s == nil {
+		return nil
+	}
+
+	return &namesilo_api.ResourceRecord{Type: namesilo_api.RecordType(s.Type), Host: s.Host, Value: s.Value, TTL: s.TTL, Distance: s.Priority}
+}
+
+// sameValue reports whether both records have the same type, host, and value,
+// whatever their TTLs and priorities.
+func sameValue(a, b namesilo_api.ResourceRecord) bool {
+	a.RecordId, a.TTL, a.Distance = b.RecordId, b.TTL, b.Distance
+	return a.EqualsRecord(b)
+}
+
+// recordsCollide reports whether two DNSRecords' records can't both be
+// published: the same record twice, since only one of them can own it, or a
+// CNAME alongside anything else at its name.
+func recordsCollide(a, b namesilo_api.ResourceRecord) bool {
+	if !a.SameHost(b) {
+		return false
+	}
+
+	if a.Type == namesilo_api.RecordTypeCNAME || b.Type == namesilo_api.RecordTypeCNAME {
+		return true
+	}
+
+	return sameValue(a, b)
+}
+
+// collidesWithSource reports whether a DNSRecord's record can't be published
+// along with the one another source wants at the same name, which is the
+// only record of its type there.
+func collidesWithSource(custom, source namesilo_api.ResourceRecord) bool {
+	if !custom.SameHost(source) {
+		return false
+	}
+
+	return custom.Type == source.Type || custom.Type == namesilo_api.RecordTypeCNAME || source.Type == namesilo_api.RecordTypeCNAME
+}
+
+// dnsRecordClaims tracks the records DNSRecords want, so that they don't
+// fight over the same one, or over a name that other sources have records
+// at. When they collide, the first to ask for one wins.
+type dnsRecordClaims struct {
+	lock   sync.Mutex
+	claims *recordClaims
+}
+
+func newDNSRecordClaims() *dnsRecordClaims {
+	return &dnsRecordClaims{claims: newRecordClaims()}
+}
+
+// add records that the DNSRecord with key wants record, and returns the
+// oldest DNSRecord that got there first, if they collide.
+func (c *dnsRecordClaims) add(key string, record namesilo_api.ResourceRecord) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.claims.add(key, record)
+	owner := c.claims.oldest(func(k string, other claim) bool {
+		return k == key || recordsCollide(record, other.record)
+	})
+
+	return owner, owner != key
+}
+
+func (c *dnsRecordClaims) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.claims.remove(key)
+}
+
+// conflictsWith returns a DNSRecord that keeps another source from having
+// record.
+func (c *dnsRecordClaims) conflictsWith(record namesilo_api.ResourceRecord) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keys := []string{}
+	for key, other := range c.claims.claims {
+		if collidesWithSource(other.record, record) {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return "", false
+	}
+
+	sort.Strings(keys)
+	return keys[0], true
+}
+
+// HandleDNSRecordExists publishes the record a DNSRecord asks for, in place of
+// the one it owned before, if any. It returns the record the DNSRecord owns
+// afterwards, which belongs in its status, even when it fails.
+func (dm *DnsManager) HandleDNSRecordExists(obj *unstructured.Unstructured) (*namesilo_api.ResourceRecord, error) {
+	dr, err := DNSRecordFromUnstructured(obj)
+	if err != nil {
+		return nil, dm.status.recordError(err)
+	}
+
+	owned := dr.ownedRecord()
+	err = dm.observeResourceEvent(dnsRecordKind, metrics.EventExists, obj, true, dnsRecordKey(dr), func() error {
+		var err error
+		owned, err = dm.handleDNSRecordExists(obj, dr, owned)
+		return err
+	})
+
+	return owned, dm.status.recordError(err)
+}
+
+func (dm *DnsManager) handleDNSRecordExists(obj runtime.Object, dr *DNSRecord, owned *namesilo_api.ResourceRecord) (*namesilo_api.ResourceRecord, error) {
+	key := dnsRecordKey(dr)
+	record, err := dr.Spec.resourceRecord(dm.BareDomainName)
+	if err != nil {
+		dm.claims.remove(key)
+		return owned, err
+	}
+
+	if other, source, ok := dm.contributors.recordAt(record.Host); ok && collidesWithSource(record, source) {
+		dm.claims.remove(key)
+		return owned, fmt.Errorf("%w: %s wants %s, but %s already has a record there", ErrRecordConflict, key, describeRecord(&record), describeContributor(other))
+	}
+
+	if other, conflict := dm.claims.add(key, record); conflict {
+		return owned, fmt.Errorf("%w: %s wants %s, but %s already has it", ErrRecordConflict, key, describeRecord(&record), other)
+	}
+
+	hosts := []string{record.Host}
+	if owned != nil && !owned.SameHost(record) {
+		hosts = append(hosts, owned.Host)
+	}
+	defer dm.lockHosts(hosts)()
+
+	cache := dm.snapshot()
+	current := findRecord(owned, cache.CurrentRecords)
+	if existing := findRecord(&record, cache.CurrentRecords); current == nil && existing != nil {
+		// A pending record is taken over, so that one created before the
+		// status could be written isn't lost. Anything else isn't nsdns's.
+		pending := dr.pendingRecord()
+		if pending == nil || !sameValue(*pending, record) {
+			return owned, fmt.Errorf("%w: %s wants %s, but it already exists, and isn't owned by it", ErrRecordConflict, key, describeRecord(&record))
+		}
+
+		current = existing
+	}
+
+	if current != nil && record.EqualsRecord(*current) {
+		log.Debugf("Record %s already up to date", describeRecord(&record))
+		return &record, nil
+	}
+
+	others := []namesilo_api.ResourceRecord{}
+	for _, r := range cache.CurrentRecords {
+		if current == nil || r.RecordId != current.RecordId {
+			others = append(others, r)
+		}
+	}
+
+	if conflicts := conflictingRecords(&record, others); len(conflicts) != 0 {
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionCreated, metrics.ReasonConflict).Inc()
+		return owned, fmt.Errorf("%w: record %s conflicts with existing records: %s", ErrConflictingRecords, describeRecord(&record), describeRecords(conflicts))
+	}
+
+	if current == nil {
+		return &record, dm.createRecord(obj, record)
+	}
+
+	if !dm.Policy.AllowsUpdate() {
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionUpdated, metrics.ReasonPolicy).Inc()
+		return current, fmt.Errorf("%w: not updating record %s; policy is %s", ErrRecordBlocked, describeRecord(current), dm.Policy)
+	}
+
+	if dm.isProtected(current.Host) {
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionUpdated, metrics.ReasonProtected).Inc()
+		dm.recordEvent(obj, apicorev1.EventTypeWarning, ReasonRecordProtected, "Not updating protected record %s", describeRecord(current))
+		return current, fmt.Errorf("%w: not updating protected record %s", ErrRecordBlocked, describeRecord(current))
+	}
+
+	// Namesilo can't move a record to another name, so the old one goes once
+	// the new one exists, unless they can't exist together, like a CNAME and
+	// any other record at the same name; then the old one goes first.
+	if !current.SameTypeAndHost(record) {
+		if recordsCollide(*current, record) {
+			deleted, err := dm.deleteRecord(obj, *current)
+			if err != nil {
+				return current, err
+			}
+
+			if !deleted {
+				return current, fmt.Errorf("%w: not deleting record %s to replace it with %s", ErrRecordBlocked, describeRecord(current), describeRecord(&record))
+			}
+
+			return &record, dm.createRecord(obj, record)
+		}
+
+		// The new record may be left from an earlier try whose delete was
+		// blocked.
+		if findRecord(&record, cache.CurrentRecords) == nil {
+			if err := dm.createRecord(obj, record); err != nil {
+				return current, err
+			}
+		}
+
+		deleted, err := dm.deleteRecord(obj, *current)
+		if err != nil {
+			return current, err
+		}
+
+		if !deleted {
+			return current, fmt.Errorf("%w: not deleting record %s to replace it with %s", ErrRecordBlocked, describeRecord(current), describeRecord(&record))
+		}
+
+		return &record, nil
+	}
+
+	if err := dm.checkHalted(metrics.ActionUpdated); err != nil {
+		return current, err
+	}
+
+	record.RecordId = current.RecordId
+	log.Debugf("Updating record %s:%s with value %s", record.Type, namesilo_api.DisplayHost(record.Host), record.Value)
+	if err := dm.Api.UpdateDNSRecord(record); err != nil {
+		return current, err
+	}
+	metrics.RecordChanges.WithLabelValues(metrics.ActionUpdated).Inc()
+	dm.recordEvent(obj, apicorev1.EventTypeNormal, ReasonRecordUpdated, "Updated record %s", describeRecord(&record))
+
+	record.RecordId = ""
+	return &record, dm.autoupdateCache()
+}
+
+func (dm *DnsManager) createRecord(obj runtime.Object, record namesilo_api.ResourceRecord) error {
+	if err := dm.checkHalted(metrics.ActionCreated); err != nil {
+		return err
+	}
+
+	log.Debugf("Creating new record %s:%s with value %s", record.Type, namesilo_api.DisplayHost(record.Host), record.Value)
+	if err := dm.Api.AddDNSRecord(record); err != nil {
+		return err
+	}
+	metrics.RecordChanges.WithLabelValues(metrics.ActionCreated).Inc()
+	dm.recordEvent(obj, apicorev1.EventTypeNormal, ReasonRecordCreated, "Created record %s", describeRecord(&record))
+
+	return dm.autoupdateCache()
+}
+
+// HandleDNSRecordDeleted deletes the record a DNSRecord owns. Records that are
+// already gone are left that way.
+func (dm *DnsManager) HandleDNSRecordDeleted(obj *unstructured.Unstructured) error {
+	dr, err := DNSRecordFromUnstructured(obj)
+	if err != nil {
+		return dm.status.recordError(err)
+	}
+
+	return dm.status.recordError(dm.observeResourceEvent(dnsRecordKind, metrics.EventDeleted, obj, true, dnsRecordKey(dr), func() error {
+		dm.claims.remove(dnsRecordKey(dr))
+
+		owned := dr.ownedRecord()
+		if owned == nil {
+			return nil
+		}
+
+		defer dm.lockHosts([]string{owned.Host})()
+
+		current := findRecord(owned, dm.snapshot().CurrentRecords)
+		if current == nil {
+			log.Debugf("Record of %s is already gone", dnsRecordKey(dr))
+			return nil
+		}
+
+		_, err := dm.deleteRecord(obj, *current)
+		return err
+	}))
+}
+
+// ForgetDNSRecord drops the claim of a DNSRecord that's gone without its
+// record being deleted.
+func (dm *DnsManager) ForgetDNSRecord(namespace, name string) {
+	dm.claims.remove(dnsRecordKind + " " + namespace + "/" + name)
+}
+
+// TrackDNSRecords notes which records existing DNSRecords want, like
+// TrackIngresses.
+func (dm *DnsManager) TrackDNSRecords(objs []*unstructured.Unstructured) {
+	sorted := make([]*unstructured.Unstructured, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := sorted[i].GetCreationTimestamp(), sorted[j].GetCreationTimestamp()
+		return ti.Before(&tj)
+	})
+
+	for _, obj := range sorted {
+		dr, err := DNSRecordFromUnstructured(obj)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+
+		record, err := dr.Spec.resourceRecord(dm.BareDomainName)
+		if err != nil {
+			continue
+		}
+
+		if other, conflict := dm.claims.add(dnsRecordKey(dr), record); conflict {
+			log.Warnf("%s wants %s, but %s already has it", dnsRecordKey(dr), describeRecord(&record), other)
+		}
+	}
+}
+
+// lockHosts holds the locks on each of hosts, in order, so that two callers
+// can't each hold one the other is waiting on.
+func (dm *DnsManager) lockHosts(hosts []string) func() {
+	sorted := make([]string, len(hosts))
+	copy(sorted, hosts)
+	sort.Strings(sorted)
+
+	unlocks := []func(){}
+	for _, host := range sorted {
+		unlocks = append(unlocks, dm.hostLocks.Lock(host))
+	}
+
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+func findRecord(record *namesilo_api.ResourceRecord, records []namesilo_api.ResourceRecord) *namesilo_api.ResourceRecord {
+	if record == nil {
+		return nil
+	}
+
+	for _, r := range records {
+		if sameValue(*record, r) {
+			return &r
+		}
+	}
+
+	return nil
+}
+
+// dnsRecordConditions sets the conditions of a DNSRecord from the result of
+// handling it.
+func dnsRecordConditions(conditions []metav1.Condition, generation int64, err error) []metav1.Condition {
+	rv := make([]metav1.Condition, len(conditions))
+	copy(rv, conditions)
+
+	ready := metav1.Condition{Type: DNSRecordReady, Status: metav1.ConditionTrue, Reason: "Published", Message: "Record is published"}
+	conflict := metav1.Condition{Type: DNSRecordConflict, Status: metav1.ConditionFalse, Reason: "NoConflict"}
+	failed := metav1.Condition{Type: DNSRecordError, Status: metav1.ConditionFalse, Reason: "NoError"}
+
+	if err != nil {
+		ready.Status, ready.Message = metav1.ConditionFalse, err.Error()
+		switch {
+		case isConflict(err):
+			ready.Reason = "Conflict"
+			conflict.Status, conflict.Reason, conflict.Message = metav1.ConditionTrue, "Conflict", err.Error()
+		case errors.Is(err, ErrRecordBlocked):
+			ready.Reason = "Blocked"
+		default:
+			ready.Reason = "Failed"
+			failed.Status, failed.Reason, failed.Message = metav1.ConditionTrue, "Failed", err.Error()
+		}
+	}
+
+	for _, c := range []metav1.Condition{ready, conflict, failed} {
+		c.ObservedGeneration = generation
+		meta.SetStatusCondition(&rv, c)
+	}
+
+	return rv
+}
+
+func isConflict(err error) bool {
+	return errors.Is(err, ErrRecordConflict) || errors.Is(err, ErrConflictingRecords)
+}
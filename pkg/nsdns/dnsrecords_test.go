@@ -0,0 +1,383 @@
+package nsdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func dnsRecord(namespace, name string, spec DNSRecordSpec) *unstructured.Unstructured {
+	obj, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(&DNSRecord{
+		TypeMeta:   metav1.TypeMeta{APIVersion: DNSRecordGroup + "/v1alpha1", Kind: "DNSRecord"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       spec,
+	})
+
+	return &unstructured.Unstructured{Object: obj}
+}
+
+// withOwnedRecord sets the status a DNSRecord would have once owned was
+// published for it.
+func withOwnedRecord(obj *unstructured.Unstructured, owned *namesilo_api.ResourceRecord) *unstructured.Unstructured {
+	status, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(&DNSRecordStatus{Record: specFromRecord(*owned)})
+	_ = unstructured.SetNestedField(obj.Object, status, "status")
+	return obj
+}
+
+func TestDNSRecordSpecResourceRecord(t *testing.T) {
+	var tests = []struct {
+		name     string
+		spec     DNSRecordSpec
+		expected namesilo_api.ResourceRecord
+		err      string
+	}{
+		{"Relative", DNSRecordSpec{Type: "txt", Host: "_dmarc", Value: "v=DMARC1; p=none"}, namesilo_api.ResourceRecord{Type: "TXT", Host: "_dmarc.example.com", Value: "v=DMARC1; p=none", TTL: 7207}, ""},
+		{"Apex", DNSRecordSpec{Type: "MX", Host: "@", Value: "Mail.Example.com.", TTL: 3600, Priority: 10}, namesilo_api.ResourceRecord{Type: "MX", Host: "example.com", Value: "mail.example.com", TTL: 3600, Distance: 10}, ""},
+		{"Qualified", DNSRecordSpec{Type: "CAA", Host: "example.com", Value: `0 issue "letsencrypt.org"`}, namesilo_api.ResourceRecord{Type: "CAA", Host: "example.com", Value: `0 issue "letsencrypt.org"`, TTL: 7207}, ""},
+		{"UnsupportedType", DNSRecordSpec{Type: "PTR", Value: "example.com"}, namesilo_api.ResourceRecord{}, "unsupported record type: PTR"},
+		{"InvalidValue", DNSRecordSpec{Type: "A", Host: "www", Value: "example.com"}, namesilo_api.ResourceRecord{}, "value \"example.com\" is not an IPv4 address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, err := tt.spec.resourceRecord("example.com")
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, rr)
+		})
+	}
+}
+
+func TestHandleDNSRecordExists(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	verification := dnsRecord("team-a", "verification", DNSRecordSpec{Type: "TXT", Value: "google-site-verification=abc"})
+	owned, err := dm.HandleDNSRecordExists(verification)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", owned.Host)
+
+	// Several TXT records can share a name.
+	spf := dnsRecord("team-a", "spf", DNSRecordSpec{Type: "TXT", Host: "@", Value: "v=spf1 -all"})
+	_, err = dm.HandleDNSRecordExists(spf)
+	assert.NoError(t, err)
+
+	// But only one DNSRecord can own each one.
+	duplicate := dnsRecord("team-b", "verification", DNSRecordSpec{Type: "TXT", Value: "google-site-verification=abc"})
+	owned, err = dm.HandleDNSRecordExists(duplicate)
+	assert.ErrorIs(t, err, ErrRecordConflict)
+	assert.Nil(t, owned)
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+
+	// Changing the value updates the record the DNSRecord owns.
+	changed := dnsRecord("team-a", "verification", DNSRecordSpec{Type: "TXT", Value: "google-site-verification=def"})
+	withOwnedRecord(changed, &namesilo_api.ResourceRecord{Type: "TXT", Host: "example.com", Value: "google-site-verification=abc", TTL: 7207})
+	owned, err = dm.HandleDNSRecordExists(changed)
+	assert.NoError(t, err)
+	assert.Equal(t, "google-site-verification=def", owned.Value)
+
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "google-site-verification=def", records[0].Value)
+	assert.Equal(t, "v=spf1 -all", records[1].Value)
+
+	assert.NoError(t, dm.HandleDNSRecordDeleted(withOwnedRecord(changed, owned)))
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "v=spf1 -all", records[0].Value)
+}
+
+func TestHandleDNSRecordExistsHostChanged(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	obj := dnsRecord("default", "mail", DNSRecordSpec{Type: "MX", Value: "mail.example.com", Priority: 10})
+	owned, err := dm.HandleDNSRecordExists(obj)
+	assert.NoError(t, err)
+
+	obj = withOwnedRecord(dnsRecord("default", "mail", DNSRecordSpec{Type: "MX", Host: "lists", Value: "mail.example.com", Priority: 10}), owned)
+	owned, err = dm.HandleDNSRecordExists(obj)
+	assert.NoError(t, err)
+	assert.Equal(t, "lists.example.com", owned.Host)
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "lists.example.com", records[0].Host)
+	assert.Equal(t, 10, records[0].Distance)
+}
+
+func TestHandleDNSRecordExistsHostChangedBlocked(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.Policy = PolicyUpsertOnly
+
+	obj := dnsRecord("default", "mail", DNSRecordSpec{Type: "MX", Value: "mail.example.com", Priority: 10})
+	owned, err := dm.HandleDNSRecordExists(obj)
+	assert.NoError(t, err)
+
+	// The old record keeps being owned, and the new one isn't added again
+	// when it's retried.
+	obj = withOwnedRecord(dnsRecord("default", "mail", DNSRecordSpec{Type: "MX", Host: "lists", Value: "mail.example.com", Priority: 10}), owned)
+	for i := 0; i < 2; i++ {
+		owned, err := dm.HandleDNSRecordExists(obj)
+		assert.ErrorIs(t, err, ErrRecordBlocked)
+		assert.Equal(t, "example.com", owned.Host)
+	}
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, 2, zone.adds)
+}
+
+// cnameZone rejects CNAMEs that would share their name with other records,
+// like Namesilo does.
+type cnameZone struct {
+	*fakeZone
+}
+
+func (z cnameZone) AddDNSRecord(rr namesilo_api.ResourceRecord) error {
+	records, _ := z.ListDNSRecords()
+	for _, r := range records {
+		if r.SameHost(rr) && (r.Type == namesilo_api.RecordTypeCNAME || rr.Type == namesilo_api.RecordTypeCNAME) {
+			return fmt.Errorf("a CNAME can't share its name with %s", describeRecord(&r))
+		}
+	}
+
+	return z.fakeZone.AddDNSRecord(rr)
+}
+
+func TestHandleDNSRecordExistsTypeChanged(t *testing.T) {
+	var tests = []struct {
+		name   string
+		before DNSRecordSpec
+		after  DNSRecordSpec
+	}{
+		{"AddressToCNAME", DNSRecordSpec{Type: "A", Host: "sub", Value: "2.2.2.2"}, DNSRecordSpec{Type: "CNAME", Host: "sub", Value: "example.com"}},
+		{"CNAMEToTXT", DNSRecordSpec{Type: "CNAME", Host: "sub", Value: "example.com"}, DNSRecordSpec{Type: "TXT", Host: "sub", Value: "v=spf1 -all"}},
+		{"TXTToMX", DNSRecordSpec{Type: "TXT", Host: "sub", Value: "v=spf1 -all"}, DNSRecordSpec{Type: "MX", Host: "sub", Value: "mail.example.com", Priority: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+			dm.Api = cnameZone{zone}
+
+			owned, err := dm.HandleDNSRecordExists(dnsRecord("default", "sub", tt.before))
+			assert.NoError(t, err)
+
+			owned, err = dm.HandleDNSRecordExists(withOwnedRecord(dnsRecord("default", "sub", tt.after), owned))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.after.Type, owned.Type.String())
+
+			records, _ := zone.ListDNSRecords()
+			assert.Len(t, records, 1)
+			assert.Equal(t, owned.Type, records[0].Type)
+			assert.Equal(t, owned.Value, records[0].Value)
+		})
+	}
+}
+
+func TestHandleDNSRecordExistsIngressConflict(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "web", "sub.example.com")))
+
+	// The Ingress's CNAME can't share its name.
+	_, err := dm.HandleDNSRecordExists(dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Host: "sub", Value: "hello"}))
+	assert.ErrorIs(t, err, ErrRecordConflict)
+	assert.Equal(t, "conflicting record: DNSRecord default/txt wants TXT sub.example.com hello, but ingress default/web already has a record there", err.Error())
+
+	// Nor can an Ingress take over a DNSRecord's name.
+	_, err = dm.HandleDNSRecordExists(dnsRecord("default", "www", DNSRecordSpec{Type: "A", Host: "www", Value: "192.168.1.1"}))
+	assert.NoError(t, err)
+
+	err = dm.HandleIngressExists(namedIngress(dm, "default", "www", "www.example.com"))
+	assert.ErrorIs(t, err, ErrRecordConflict)
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+}
+
+func TestHandleDNSRecordExistsExistingConflict(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	assert.NoError(t, zone.AddDNSRecord(namesilo_api.ResourceRecord{Type: "CNAME", Host: "sub.example.com", Value: "elsewhere.com", TTL: 3600}))
+	assert.NoError(t, dm.UpdateCache())
+
+	_, err := dm.HandleDNSRecordExists(dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Host: "sub", Value: "hello"}))
+	assert.ErrorIs(t, err, ErrConflictingRecords)
+}
+
+func TestHandleDNSRecordExistsAdoption(t *testing.T) {
+	existing := namesilo_api.ResourceRecord{Type: "TXT", Host: "example.com", Value: "hello", TTL: 7207}
+
+	var tests = []struct {
+		name    string
+		pending *namesilo_api.ResourceRecord
+		err     error
+	}{
+		{"Pending", &existing, nil},
+		{"NotPending", nil, ErrRecordConflict},
+		{"OtherPending", &namesilo_api.ResourceRecord{Type: "TXT", Host: "example.com", Value: "goodbye", TTL: 7207}, ErrRecordConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+			assert.NoError(t, zone.AddDNSRecord(existing))
+			assert.NoError(t, dm.UpdateCache())
+
+			obj := dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Value: "hello"})
+			if tt.pending != nil {
+				status, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(&DNSRecordStatus{PendingRecord: specFromRecord(*tt.pending)})
+				assert.NoError(t, unstructured.SetNestedField(obj.Object, status, "status"))
+			}
+
+			owned, err := dm.HandleDNSRecordExists(obj)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, owned)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "hello", owned.Value)
+			}
+
+			records, _ := zone.ListDNSRecords()
+			assert.Len(t, records, 1)
+			assert.Equal(t, 1, zone.adds)
+		})
+	}
+}
+
+func TestHandleDNSRecordExistsPolicy(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.Policy = PolicyCreateOnly
+
+	obj := dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Value: "hello"})
+	owned, err := dm.HandleDNSRecordExists(obj)
+	assert.NoError(t, err)
+
+	obj = withOwnedRecord(dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Value: "goodbye"}), owned)
+	owned, err = dm.HandleDNSRecordExists(obj)
+	assert.ErrorIs(t, err, ErrRecordBlocked)
+	assert.Equal(t, "hello", owned.Value)
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "hello", records[0].Value)
+}
+
+func TestDNSRecordConditions(t *testing.T) {
+	var tests = []struct {
+		name     string
+		err      error
+		ready    metav1.ConditionStatus
+		conflict metav1.ConditionStatus
+		failed   metav1.ConditionStatus
+	}{
+		{"Published", nil, metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionFalse},
+		{"Conflict", ErrRecordConflict, metav1.ConditionFalse, metav1.ConditionTrue, metav1.ConditionFalse},
+		{"ConflictingRecords", ErrConflictingRecords, metav1.ConditionFalse, metav1.ConditionTrue, metav1.ConditionFalse},
+		{"Blocked", ErrRecordBlocked, metav1.ConditionFalse, metav1.ConditionFalse, metav1.ConditionFalse},
+		{"Error", errors.New("namesilo is down"), metav1.ConditionFalse, metav1.ConditionFalse, metav1.ConditionTrue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := dnsRecordConditions(nil, 2, tt.err)
+			assert.Len(t, conditions, 3)
+			assert.Equal(t, tt.ready, meta.FindStatusCondition(conditions, DNSRecordReady).Status)
+			assert.Equal(t, tt.conflict, meta.FindStatusCondition(conditions, DNSRecordConflict).Status)
+			assert.Equal(t, tt.failed, meta.FindStatusCondition(conditions, DNSRecordError).Status)
+			assert.Equal(t, int64(2), conditions[0].ObservedGeneration)
+		})
+	}
+}
+
+func TestDNSRecordController(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	obj := dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Value: "hello"})
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{DNSRecordResource: "DNSRecordList"}, obj)
+	resource := client.Resource(DNSRecordResource).Namespace("default")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	controller := newDNSRecordController(dm, client, factory.ForResource(DNSRecordResource), workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	go controller.Run(ctx, 2)
+
+	assert.Eventually(t, func() bool {
+		obj, err := resource.Get(context.Background(), "txt", metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+
+		dr, err := DNSRecordFromUnstructured(obj)
+		return err == nil && meta.IsStatusConditionTrue(dr.Status.Conditions, DNSRecordReady) && dr.Status.Record != nil && dr.Status.PendingRecord == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+
+	// The fake client deletes objects right away, whatever their finalizers,
+	// so the deletion is started by hand.
+	obj, err := resource.Get(context.Background(), "txt", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{CleanupFinalizer}, obj.GetFinalizers())
+
+	now := metav1.Now()
+	obj.SetDeletionTimestamp(&now)
+	_, err = resource.Update(context.Background(), obj, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		records, _ := zone.ListDNSRecords()
+		obj, err := resource.Get(context.Background(), "txt", metav1.GetOptions{})
+		return len(records) == 0 && err == nil && len(obj.GetFinalizers()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDNSRecordControllerMarksPending(t *testing.T) {
+	dm, _ := testDnsManager(t)
+
+	obj := dnsRecord("default", "txt", DNSRecordSpec{Type: "TXT", Value: "hello"})
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{DNSRecordResource: "DNSRecordList"}, obj)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	controller := NewDNSRecordController(dm, client, factory.ForResource(DNSRecordResource))
+
+	marked, err := controller.markPending(obj)
+	assert.NoError(t, err)
+
+	stored, err := client.Resource(DNSRecordResource).Namespace("default").Get(context.Background(), "txt", metav1.GetOptions{})
+	assert.NoError(t, err)
+	dr, err := DNSRecordFromUnstructured(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, &DNSRecordSpec{Type: "TXT", Host: "example.com", Value: "hello", TTL: 7207}, dr.Status.PendingRecord)
+	assert.Nil(t, dr.Status.Record)
+
+	// Once it's pending, it isn't written again.
+	again, err := controller.markPending(marked)
+	assert.NoError(t, err)
+	assert.Same(t, marked, again)
+}
@@ -0,0 +1,136 @@
+package nsdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+const EventComponent string = "nsdns"
+
+const (
+	ReasonRecordCreated   string = "RecordCreated"
+	ReasonRecordUpdated   string = "RecordUpdated"
+	ReasonRecordDeleted   string = "RecordDeleted"
+	ReasonRecordFailed    string = "RecordFailed"
+	ReasonRecordProtected string = "RecordProtected"
+	ReasonRecordConflict  string = "RecordConflict"
+	ReasonChangesHalted   string = "ChangesHalted"
+)
+
+// RecordsAnnotation is set on Ingresses to summarize their records, and the
+// result of the last time they were handled.
+const RecordsAnnotation string = "nsdns.io/records"
+
+const (
+	ResultSynced string = "Synced"
+	ResultFailed string = "Failed"
+)
+
+type RecordsAnnotationValue struct {
+	Records []string  `json:"records"`
+	Result  string    `json:"result"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// IngressAnnotator sets an annotation on an Ingress.
+type IngressAnnotator func(ingress *apinetworkingv1.Ingress, key, value string) error
+
+// NewEventRecorder returns a recorder that sends Events to the cluster, and
+// the function to stop it once it's no longer needed.
+func NewEventRecorder(clientset kubernetes.Interface) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	recorder := broadcaster.NewRecorder(scheme.Scheme, apicorev1.EventSource{Component: EventComponent})
+	return recorder, broadcaster.Shutdown
+}
+
+// NewIngressAnnotator patches annotations onto Ingresses, leaving the rest of
+// the object alone.
+func NewIngressAnnotator(clientset kubernetes.Interface) IngressAnnotator {
+	return func(ingress *apinetworkingv1.Ingress, key, value string) error {
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{key: value},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = clientset.NetworkingV1().Ingresses(ingress.Namespace).Patch(context.TODO(), ingress.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	}
+}
+
+func describeRecord(rr *namesilo_api.ResourceRecord) string {
+	return fmt.Sprintf("%s %s %s", rr.Type, namesilo_api.DisplayHost(rr.Host), rr.Value)
+}
+
+// recordEvent skips changes made for no object in particular, like following
+// the public IP.
+func (dm *DnsManager) recordEvent(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if dm.Recorder == nil || object == nil {
+		return
+	}
+
+	dm.Recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// annotateIngress summarizes the outcome of handling ingress in its
+// annotation. It's only written when the summary changes, other than its
+// time, so that the updates it causes don't lead to it being written again.
+func (dm *DnsManager) annotateIngress(ingress *apinetworkingv1.Ingress, handleErr error) {
+	if dm.Annotator == nil {
+		return
+	}
+
+	value := RecordsAnnotationValue{Records: []string{}, Result: ResultSynced, Time: time.Now().UTC()}
+	if record, err := dm.recordFromSource(ingressSource(ingress), dm.snapshot().CurrentIpAddress); err == nil {
+		value.Records = append(value.Records, describeRecord(record))
+	}
+
+	if handleErr != nil {
+		value.Result = ResultFailed
+		value.Message = handleErr.Error()
+	}
+
+	var current RecordsAnnotationValue
+	if existing, ok := ingress.Annotations[RecordsAnnotation]; ok && json.Unmarshal([]byte(existing), &current) == nil {
+		current.Time = value.Time
+		if reflect.DeepEqual(current, value) {
+			return
+		}
+	}
+
+	annotation, err := json.Marshal(value)
+	if err != nil {
+		log.Errorf("Failed to encode %s annotation: %s", RecordsAnnotation, err.Error())
+		return
+	}
+
+	if err := dm.Annotator(ingress, RecordsAnnotation, string(annotation)); err != nil {
+		log.Errorf("Failed to annotate ingress %s/%s: %s", ingress.Namespace, ingress.Name, err.Error())
+	}
+}
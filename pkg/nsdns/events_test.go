@@ -0,0 +1,104 @@
+package nsdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func TestHandleIngressEvents(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	recorder := record.NewFakeRecorder(10)
+	dm.Recorder = recorder
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	nsapi.On("AddDNSRecord", mock.Anything).Return(nil).Once()
+	nsapi.On("AddDNSRecord", mock.Anything).Return(errors.New("namesilo is down")).Once()
+
+	ingress := ingressWithClass(dm, "sub.example.com")
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+	assert.Equal(t, "Normal RecordCreated Created record CNAME sub.example.com example.com", <-recorder.Events)
+
+	assert.Error(t, dm.HandleIngressExists(ingress))
+	assert.Equal(t, "Warning RecordFailed Failed to sync DNS record: namesilo is down", <-recorder.Events)
+
+	rr := namesilo_api.ResourceRecord{RecordId: "1234", Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, rr)
+	nsapi.On("DeleteDNSRecord", rr).Return(nil).Once()
+
+	assert.NoError(t, dm.HandleIngressDeleted(ingress))
+	assert.Equal(t, "Normal RecordDeleted Deleted record CNAME sub.example.com example.com", <-recorder.Events)
+
+	// Skipped ingresses get no events.
+	assert.NoError(t, dm.HandleIngressExists(ingressWithHost("other.example.com")))
+	assert.Len(t, recorder.Events, 0)
+
+	nsapi.AssertExpectations(t)
+}
+
+func TestAnnotateIngress(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	annotations := []string{}
+	dm.Annotator = func(ingress *apinetworkingv1.Ingress, key, value string) error {
+		assert.Equal(t, RecordsAnnotation, key)
+		annotations = append(annotations, value)
+		return nil
+	}
+
+	ingress := ingressWithClass(dm, "sub.example.com")
+	dm.annotateIngress(ingress, nil)
+	assert.Len(t, annotations, 1)
+
+	var value RecordsAnnotationValue
+	assert.NoError(t, json.Unmarshal([]byte(annotations[0]), &value))
+	assert.Equal(t, []string{"CNAME sub.example.com example.com"}, value.Records)
+	assert.Equal(t, ResultSynced, value.Result)
+	assert.Equal(t, "", value.Message)
+
+	// Nothing's changed, so the annotation isn't rewritten.
+	ingress.Annotations[RecordsAnnotation] = annotations[0]
+	dm.annotateIngress(ingress, nil)
+	assert.Len(t, annotations, 1)
+
+	dm.annotateIngress(ingress, errors.New("namesilo is down"))
+	assert.Len(t, annotations, 2)
+
+	assert.NoError(t, json.Unmarshal([]byte(annotations[1]), &value))
+	assert.Equal(t, ResultFailed, value.Result)
+	assert.Equal(t, "namesilo is down", value.Message)
+}
+
+func TestNewIngressAnnotator(t *testing.T) {
+	ingress := ingressWithHost("sub.example.com")
+	ingress.Name = "web"
+	ingress.Namespace = "default"
+	ingress.Annotations = map[string]string{"kubernetes.io/ingress.class": "b"}
+	clientset := fake.NewSimpleClientset(ingress)
+
+	annotate := NewIngressAnnotator(clientset)
+	assert.NoError(t, annotate(ingress, RecordsAnnotation, "{}"))
+
+	patched, err := clientset.NetworkingV1().Ingresses("default").Get(context.Background(), "web", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"kubernetes.io/ingress.class": "b", RecordsAnnotation: "{}"}, patched.Annotations)
+}
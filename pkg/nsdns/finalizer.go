@@ -0,0 +1,61 @@
+package nsdns
+
+import (
+	"context"
+	"encoding/json"
+)
+
+import (
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CleanupFinalizer keeps managed Ingresses around after they're deleted,
+// until their records have been removed.
+const CleanupFinalizer string = "nsdns.io/cleanup"
+
+// IngressFinalizerSetter replaces the finalizers on an Ingress.
+type IngressFinalizerSetter func(ingress *apinetworkingv1.Ingress, finalizers []string) error
+
+// NewIngressFinalizerSetter patches finalizers onto Ingresses. The patch only
+// applies to the version of the Ingress given, so that finalizers added by
+// anything else in the meantime aren't dropped.
+func NewIngressFinalizerSetter(clientset kubernetes.Interface) IngressFinalizerSetter {
+	return func(ingress *apinetworkingv1.Ingress, finalizers []string) error {
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"finalizers":      finalizers,
+				"resourceVersion": ingress.ResourceVersion,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = clientset.NetworkingV1().Ingresses(ingress.Namespace).Patch(context.TODO(), ingress.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	}
+}
+
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func withoutFinalizer(finalizers []string, finalizer string) []string {
+	rv := []string{}
+	for _, f := range finalizers {
+		if f != finalizer {
+			rv = append(rv, f)
+		}
+	}
+
+	return rv
+}
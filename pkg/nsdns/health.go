@@ -0,0 +1,75 @@
+package nsdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+)
+
+// Ready reports why the manager can't be trusted to handle events yet, if it
+// can't. The informer must have synced, and unless the manager is on standby
+// waiting for leadership, the cache must have been refreshed within
+// maxCacheAge, and changes mustn't be halted by MaxDeletesPerSync.
+func (dm *DnsManager) Ready(informerSynced func() bool, maxCacheAge time.Duration) error {
+	if !informerSynced() {
+		return fmt.Errorf("informer has not synced")
+	}
+
+	if dm.Standby() {
+		return nil
+	}
+
+	lastSync := dm.LastSyncTime()
+	if lastSync.IsZero() {
+		return fmt.Errorf("cache has never been updated")
+	}
+
+	if age := time.Since(lastSync); age > maxCacheAge {
+		return fmt.Errorf("cache was last updated %s ago", age.Round(time.Second))
+	}
+
+	if dm.deletes.isExceeded() {
+		return fmt.Errorf("changes are halted until the next sync, after trying to delete more than %d records", dm.MaxDeletesPerSync)
+	}
+
+	return nil
+}
+
+// NewHealthHandler serves the probes used by Kubernetes, along with a JSON
+// summary of the manager's state and Prometheus metrics.
+func NewHealthHandler(dm *DnsManager, informerSynced func() bool, maxCacheAge time.Duration) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := dm.Ready(informerSynced, maxCacheAge); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dm.Status()); err != nil {
+			log.Errorf("Failed to write status: %s", err.Error())
+		}
+	})
+
+	mux.Handle("/metrics", metrics.Handler())
+
+	return mux
+}
@@ -0,0 +1,123 @@
+package nsdns
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func TestReady(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	synced := false
+	informerSynced := func() bool { return synced }
+
+	assert.Equal(t, "informer has not synced", dm.Ready(informerSynced, time.Hour).Error())
+
+	synced = true
+	assert.Equal(t, "cache has never been updated", dm.Ready(informerSynced, time.Hour).Error())
+
+	dm.status.lastSync = time.Now().Add(-2 * time.Hour)
+	assert.Equal(t, "cache was last updated 2h0m0s ago", dm.Ready(informerSynced, time.Hour).Error())
+
+	dm.status.recordSync()
+	assert.NoError(t, dm.Ready(informerSynced, time.Hour))
+}
+
+func TestReadyStandby(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	dm.SetStandby(true)
+
+	assert.Equal(t, "informer has not synced", dm.Ready(func() bool { return false }, time.Hour).Error())
+	assert.NoError(t, dm.Ready(func() bool { return true }, time.Hour))
+	assert.True(t, dm.Status().Standby)
+
+	dm.SetStandby(false)
+	assert.Equal(t, "cache has never been updated", dm.Ready(func() bool { return true }, time.Hour).Error())
+}
+
+func TestHealthHandler(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	synced := true
+	server := httptest.NewServer(NewHealthHandler(dm, func() bool { return synced }, time.Hour))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/healthz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, err = http.Get(server.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	dm.status.recordSync()
+
+	response, err = http.Get(server.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	synced = false
+
+	response, err = http.Get(server.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
+
+func TestStatusHandler(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, namesilo_api.ResourceRecord{})
+	dm.status.recordSync()
+	dm.status.recordError(errors.New("something went wrong"))
+
+	server := httptest.NewServer(NewHealthHandler(dm, func() bool { return true }, time.Hour))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/status")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+	var status DnsManagerStatus
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+
+	assert.Equal(t, "1.1.1.1", status.CurrentIpAddress)
+	assert.Equal(t, 1, status.RecordCount)
+	assert.NotNil(t, status.LastSyncTime)
+	assert.Equal(t, 1, len(status.LastErrors))
+	assert.Equal(t, "something went wrong", status.LastErrors[0].Message)
+}
+
+func TestStatusKeepsRecentErrors(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+
+	for i := 0; i < maxRecentErrors+5; i++ {
+		dm.HandleIngressDeleted(ingressWithClass(dm, "example.com"))
+	}
+
+	status := dm.Status()
+	assert.Nil(t, status.LastSyncTime)
+	assert.Equal(t, maxRecentErrors, len(status.LastErrors))
+	assert.Equal(t, "failed to find record: A:example.com", status.LastErrors[0].Message)
+}
@@ -0,0 +1,114 @@
+package nsdns
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const DefaultLeaseName string = "nsdns"
+const DefaultLeaseDuration time.Duration = 15 * time.Second
+const DefaultLeaseRenewDeadline time.Duration = 10 * time.Second
+const DefaultLeaseRetryPeriod time.Duration = 2 * time.Second
+
+const serviceAccountNamespaceFile string = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+type LeaderElectionConfig struct {
+	LeaseName      string
+	LeaseNamespace string
+	Identity       string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// NewLeaderElectionConfig uses the default timings, and identifies this
+// replica by its hostname, which is the pod name when running in a cluster.
+func NewLeaderElectionConfig(leaseName, leaseNamespace string) (*LeaderElectionConfig, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderElectionConfig{
+		leaseName,
+		leaseNamespace,
+		identity,
+		DefaultLeaseDuration,
+		DefaultLeaseRenewDeadline,
+		DefaultLeaseRetryPeriod,
+	}, nil
+}
+
+// CurrentNamespace returns the namespace of the service account the process
+// is running as, or "default" outside of a cluster.
+func CurrentNamespace() string {
+	if namespace, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(namespace))
+	}
+
+	return "default"
+}
+
+// RunAsLeader blocks until this replica holds the Lease, then calls lead with
+// a context that's cancelled if the Lease is lost. It returns once ctx is
+// cancelled or leadership is lost, releasing the Lease on the way out.
+func RunAsLeader(ctx context.Context, clientset kubernetes.Interface, config LeaderElectionConfig, lead func(context.Context)) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      config.LeaseName,
+			Namespace: config.LeaseNamespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: config.Identity,
+		},
+	}
+
+	var leading atomic.Bool
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   config.LeaseDuration,
+		RenewDeadline:   config.RenewDeadline,
+		RetryPeriod:     config.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            config.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				leading.Store(true)
+				log.Infof("%s is now the leader of %s/%s", config.Identity, config.LeaseNamespace, config.LeaseName)
+				lead(ctx)
+			},
+			OnStoppedLeading: func() {
+				if !leading.Load() {
+					return
+				}
+
+				log.Infof("%s is no longer the leader of %s/%s", config.Identity, config.LeaseNamespace, config.LeaseName)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != config.Identity {
+					log.Infof("Following %s as the leader of %s/%s", identity, config.LeaseNamespace, config.LeaseName)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Waiting to acquire lease %s/%s as %s", config.LeaseNamespace, config.LeaseName, config.Identity)
+	elector.Run(ctx)
+	return nil
+}
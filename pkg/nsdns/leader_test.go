@@ -0,0 +1,78 @@
+package nsdns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testLeaderElectionConfig(identity string) LeaderElectionConfig {
+	return LeaderElectionConfig{
+		LeaseName:      "nsdns",
+		LeaseNamespace: "default",
+		Identity:       identity,
+		LeaseDuration:  2 * time.Second,
+		RenewDeadline:  time.Second,
+		RetryPeriod:    100 * time.Millisecond,
+	}
+}
+
+func TestRunAsLeader(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	led := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- RunAsLeader(ctx, clientset, testLeaderElectionConfig("a"), func(ctx context.Context) {
+			close(led)
+		})
+	}()
+
+	select {
+	case <-led:
+	case <-time.After(5 * time.Second):
+		t.Fatal("never became the leader")
+	}
+
+	lease, err := clientset.CoordinationV1().Leases("default").Get(context.Background(), "nsdns", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", *lease.Spec.HolderIdentity)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	// The lease is released, so that another replica can take over without
+	// waiting for it to expire.
+	lease, err = clientset.CoordinationV1().Leases("default").Get(context.Background(), "nsdns", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", *lease.Spec.HolderIdentity)
+}
+
+func TestRunAsLeaderWaitsForLease(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	led := make(chan struct{})
+	go RunAsLeader(ctx, clientset, testLeaderElectionConfig("a"), func(ctx context.Context) {
+		close(led)
+		<-ctx.Done()
+	})
+	<-led
+
+	followerCtx, followerCancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer followerCancel()
+
+	followed := false
+	assert.NoError(t, RunAsLeader(followerCtx, clientset, testLeaderElectionConfig("b"), func(ctx context.Context) {
+		followed = true
+	}))
+	assert.False(t, followed)
+}
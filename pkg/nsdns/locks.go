@@ -0,0 +1,47 @@
+package nsdns
+
+import (
+	"sync"
+)
+
+// hostLocks serializes changes to each hostname, without holding up changes
+// to others. Locks are dropped once nothing holds or waits on them.
+type hostLocks struct {
+	lock  sync.Mutex
+	hosts map[string]*hostLock
+}
+
+type hostLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newHostLocks() *hostLocks {
+	return &hostLocks{hosts: map[string]*hostLock{}}
+}
+
+// Lock blocks until host is free, and returns the function to release it.
+func (h *hostLocks) Lock(host string) func() {
+	h.lock.Lock()
+	l, ok := h.hosts[host]
+	if !ok {
+		l = &hostLock{}
+		h.hosts[host] = l
+	}
+	l.refs++
+	h.lock.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(h.hosts, host)
+		}
+	}
+}
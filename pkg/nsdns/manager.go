@@ -1,21 +1,37 @@
 package nsdns
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 import (
 	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
 	apinetworkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 )
 
 import (
 	"github.com/Eagerod/kube-namesilo-dns/pkg/icanhazip"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
 	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
 )
 
+// ErrRecordNotFound is returned when the record of a deleted Ingress is
+// already gone.
+var ErrRecordNotFound = errors.New("failed to find record")
+
+// ErrRecordConflict is returned when an Ingress wants a different record for
+// its hostname than another Ingress that already has one.
+var ErrRecordConflict = errors.New("conflicting record")
+
 type dnsManagerCache struct {
 	CurrentRecords   []namesilo_api.ResourceRecord
 	CurrentIpAddress string
@@ -28,21 +44,58 @@ func NewDnsManagerCache() *dnsManagerCache {
 	}
 }
 
+// DnsManager is safe for concurrent use. Events for the same hostname are
+// handled one at a time; when RefreshesCacheOnUpdate is set, each one sees
+// the records created by the last.
 type DnsManager struct {
 	BareDomainName     string
 	TargetIngressClass string
 
+	// Gateway API routes are only handled with a RouteFilter.
+	RouteFilter *RouteFilter
+
 	Api namesilo_api.NamesiloApi
 
-	cacheLock              *sync.Mutex
+	// With FlattensCNAMEs, hosts other than the domain get address records
+	// pointing at the public IP instead of CNAMEs to the domain, so that they
+	// can have other records too. Ingresses can override it with the
+	// CNAMEFlatteningAnnotation.
+	FlattensCNAMEs bool
+
+	// Events and annotations are only written to Ingresses when these are set.
+	Recorder  record.EventRecorder
+	Annotator IngressAnnotator
+
+	// Safeguards against changes made by mistake, like by a misconfigured
+	// ingress class. A MaxDeletesPerSync of 0 allows any number of deletes.
+	Policy            Policy
+	MaxDeletesPerSync int
+	ConflictPolicy    ConflictPolicy
+	protectedHosts    map[string]bool
+	deletes           *deleteBudget
+
+	cacheLock              *sync.RWMutex
 	cache                  *dnsManagerCache
 	RefreshesCacheOnUpdate bool
+
+	// Refreshes can overlap, so each is numbered when it starts, and the cache
+	// only takes results newer than the ones it has. Otherwise, records fetched
+	// before a change could replace ones fetched after it.
+	refreshes       *atomic.Uint64
+	cacheGeneration uint64
+
+	status       *dnsManagerStatus
+	hostLocks    *hostLocks
+	contributors *recordContributors
+	claims       *dnsRecordClaims
+	managed      *managedRecords
+	publicIp     func() (string, error)
 }
 
 func NewDnsManager(domainName, ingressClass string) (*DnsManager, error) {
-	nsApiKey := os.Getenv("NAMESILO_API_KEY")
-	if nsApiKey == "" {
-		return nil, fmt.Errorf("failed to find NAMESILO_API_KEY in environment; cannot proceed")
+	nsApiKey, err := ApiKeyFromEnvironment(ApiKeyEnvironmentVariable)()
+	if err != nil {
+		return nil, err
 	}
 
 	return NewDnsManagerWithApiKey(domainName, ingressClass, nsApiKey)
@@ -57,20 +110,52 @@ func NewDnsManagerWithApiKey(domainName, ingressClass, apiKey string) (*DnsManag
 		return nil, fmt.Errorf("must provide an ingress class to generate DNS records")
 	}
 
+	domainName, err := namesilo_api.CanonicalHost(domainName)
+	if err != nil {
+		return nil, err
+	}
+
 	api := namesilo_api.NewNamesiloApi(domainName, apiKey)
 
 	dm := DnsManager{
 		domainName,
 		ingressClass,
+		nil,
 		api,
-		&sync.Mutex{},
+		false,
+		nil,
+		nil,
+		PolicySync,
+		0,
+		ConflictPolicyFail,
+		map[string]bool{},
+		&deleteBudget{},
+		&sync.RWMutex{},
 		NewDnsManagerCache(),
 		false,
+		&atomic.Uint64{},
+		0,
+		newDnsManagerStatus(),
+		newHostLocks(),
+		newRecordContributors(),
+		newDNSRecordClaims(),
+		newManagedRecords(),
+		icanhazip.GetPublicIP,
 	}
 
 	return &dm, nil
 }
 
+func (dm *DnsManager) SetApiKey(apiKey string) error {
+	setter, ok := dm.Api.(namesilo_api.ApiKeySetter)
+	if !ok {
+		return fmt.Errorf("namesilo api client does not support changing api keys")
+	}
+
+	setter.SetApiKey(apiKey)
+	return nil
+}
+
 func (dm *DnsManager) ShouldProcessIngress(ingress *apinetworkingv1.Ingress) bool {
 	ic, ok := ingress.Annotations["kubernetes.io/ingress.class"]
 	if !ok {
@@ -81,61 +166,283 @@ func (dm *DnsManager) ShouldProcessIngress(ingress *apinetworkingv1.Ingress) boo
 }
 
 func (dm *DnsManager) HandleIngressExists(ingress *apinetworkingv1.Ingress) error {
+	return dm.status.recordError(dm.observeIngressEvent(metrics.EventExists, ingress, dm.handleIngressExists))
+}
+
+func (dm *DnsManager) handleIngressExists(ingress *apinetworkingv1.Ingress) error {
 	if !dm.ShouldProcessIngress(ingress) {
 		return nil
 	}
 
-	record, err := NamesiloRecordFromIngress(ingress, dm.BareDomainName, dm.cache.CurrentIpAddress)
+	return dm.handleRecordExists(ingressSource(ingress))
+}
+
+func (dm *DnsManager) handleRecordExists(src recordSource) error {
+	record, cache, unlock, err := dm.lockRecord(src)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	for _, r := range dm.cache.CurrentRecords {
-		if record.Type == r.Type && record.Host == r.Host {
+	if err := dm.trackSource(src); err != nil {
+		return err
+	}
+
+	for _, r := range cache.CurrentRecords {
+		if record.SameTypeAndHost(r) {
 			if record.EqualsRecord(r) {
-				log.Debugf("Record %s:%s already up to date", record.Type, record.Host)
+				log.Debugf("Record %s:%s already up to date", record.Type, namesilo_api.DisplayHost(record.Host))
+				dm.managed.add(r, nil)
 				return nil
 			}
 
+			if !dm.Policy.AllowsUpdate() {
+				log.Infof("Not updating record %s:%s; policy is %s", record.Type, namesilo_api.DisplayHost(record.Host), dm.Policy)
+				metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionUpdated, metrics.ReasonPolicy).Inc()
+				return nil
+			}
+
+			if dm.isProtected(record.Host) {
+				log.Warnf("Not updating protected record %s:%s", record.Type, namesilo_api.DisplayHost(record.Host))
+				metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionUpdated, metrics.ReasonProtected).Inc()
+				dm.recordEvent(src.object, apicorev1.EventTypeWarning, ReasonRecordProtected, "Not updating protected record %s", describeRecord(&r))
+				return nil
+			}
+
+			if err := dm.checkHalted(metrics.ActionUpdated); err != nil {
+				return err
+			}
+
 			record.RecordId = r.RecordId
-			log.Debugf("Updating record %s:%s with value %s", record.Type, record.Host, record.Value)
+			log.Debugf("Updating record %s:%s with value %s", record.Type, namesilo_api.DisplayHost(record.Host), record.Value)
 			if err := dm.Api.UpdateDNSRecord(*record); err != nil {
 				return err
 			}
+			dm.managed.add(*record, &r)
+			metrics.RecordChanges.WithLabelValues(metrics.ActionUpdated).Inc()
+			dm.recordEvent(src.object, apicorev1.EventTypeNormal, ReasonRecordUpdated, "Updated record %s", describeRecord(record))
 
 			return dm.autoupdateCache()
 		}
 	}
 
-	log.Debugf("Creating new record %s:%s with value %s", record.Type, record.Host, record.Value)
+	if create, err := dm.resolveConflicts(src.object, record, cache.CurrentRecords); !create {
+		return err
+	}
+
+	if err := dm.checkHalted(metrics.ActionCreated); err != nil {
+		return err
+	}
+
+	log.Debugf("Creating new record %s:%s with value %s", record.Type, namesilo_api.DisplayHost(record.Host), record.Value)
 	if err := dm.Api.AddDNSRecord(*record); err != nil {
 		return err
 	}
+	dm.managed.add(*record, nil)
+	metrics.RecordChanges.WithLabelValues(metrics.ActionCreated).Inc()
+	dm.recordEvent(src.object, apicorev1.EventTypeNormal, ReasonRecordCreated, "Created record %s", describeRecord(record))
 	return dm.autoupdateCache()
 }
 
 func (dm *DnsManager) HandleIngressDeleted(ingress *apinetworkingv1.Ingress) error {
+	return dm.status.recordError(dm.observeIngressEvent(metrics.EventDeleted, ingress, dm.handleIngressDeleted))
+}
+
+func (dm *DnsManager) handleIngressDeleted(ingress *apinetworkingv1.Ingress) error {
 	if !dm.ShouldProcessIngress(ingress) {
 		return nil
 	}
 
-	record, err := NamesiloRecordFromIngress(ingress, dm.BareDomainName, dm.cache.CurrentIpAddress)
+	return dm.handleRecordDeleted(ingressSource(ingress))
+}
+
+func (dm *DnsManager) handleRecordDeleted(src recordSource) error {
+	record, cache, unlock, err := dm.lockRecord(src)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	for _, r := range dm.cache.CurrentRecords {
-		if record.Type == r.Type && record.Host == r.Host {
-			log.Infof("Deleting resource record %s", r.RecordId)
-			if err := dm.Api.DeleteDNSRecord(r); err != nil {
-				return err
-			}
+	return dm.deleteSourceRecord(src.object, src.key, *record, cache)
+}
 
-			return dm.autoupdateCache()
+// handleHostnameDropped deletes record, which the source with key wanted for
+// a hostname that object no longer has. Records that fail to be deleted are
+// still wanted by the source, so that they're tried again the next time
+// object is handled.
+func (dm *DnsManager) handleHostnameDropped(object runtime.Object, key string, record namesilo_api.ResourceRecord) error {
+	defer dm.hostLocks.Lock(record.Host)()
+
+	err := dm.deleteSourceRecord(object, key, record, dm.snapshot())
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		dm.contributors.add(key, record)
+	}
+
+	return err
+}
+
+// deleteSourceRecord deletes the record of the source with key, unless other
+// sources still want it. The host's lock must be held.
+func (dm *DnsManager) deleteSourceRecord(object runtime.Object, key string, record namesilo_api.ResourceRecord, cache *dnsManagerCache) error {
+	if others := dm.contributors.remove(key, record.Host); len(others) != 0 {
+		for i, other := range others {
+			others[i] = describeContributor(other)
+		}
+
+		log.Infof("Keeping record %s:%s, which is still wanted by %s", record.Type, namesilo_api.DisplayHost(record.Host), strings.Join(others, ", "))
+		return nil
+	}
+
+	for _, r := range cache.CurrentRecords {
+		if record.SameTypeAndHost(r) {
+			_, err := dm.deleteRecord(object, r)
+			return err
 		}
 	}
 
-	return fmt.Errorf("failed to find record: %s:%s", record.Type, record.Host)
+	return fmt.Errorf("%w: %s:%s", ErrRecordNotFound, record.Type, record.Host)
+}
+
+// deleteRecord deletes r on behalf of object, unless the safeguards say not
+// to. It returns whether r was deleted.
+func (dm *DnsManager) deleteRecord(object runtime.Object, r namesilo_api.ResourceRecord) (bool, error) {
+	if !dm.Policy.AllowsDelete() {
+		log.Infof("Not deleting record %s:%s; policy is %s", r.Type, namesilo_api.DisplayHost(r.Host), dm.Policy)
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionDeleted, metrics.ReasonPolicy).Inc()
+		return false, nil
+	}
+
+	if dm.isProtected(r.Host) {
+		log.Warnf("Not deleting protected record %s:%s", r.Type, namesilo_api.DisplayHost(r.Host))
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionDeleted, metrics.ReasonProtected).Inc()
+		dm.recordEvent(object, apicorev1.EventTypeWarning, ReasonRecordProtected, "Not deleting protected record %s", describeRecord(&r))
+		return false, nil
+	}
+
+	if err := dm.checkHalted(metrics.ActionDeleted); err != nil {
+		return false, err
+	}
+
+	if !dm.deletes.take(dm.MaxDeletesPerSync) {
+		metrics.RecordChangesBlocked.WithLabelValues(metrics.ActionDeleted, metrics.ReasonMaxDeletes).Inc()
+		log.Errorf("Already deleted %d records since the last sync; halting all changes until the next one", dm.MaxDeletesPerSync)
+		dm.recordEvent(object, apicorev1.EventTypeWarning, ReasonChangesHalted, "Not deleting record %s; already deleted %d records since the last sync, so all changes are halted until the next one", describeRecord(&r), dm.MaxDeletesPerSync)
+		return false, fmt.Errorf("%w: already deleted %d records since the last sync; not deleting %s:%s, or making any other changes, until the next one", ErrTooManyDeletes, dm.MaxDeletesPerSync, r.Type, namesilo_api.DisplayHost(r.Host))
+	}
+
+	log.Infof("Deleting resource record %s (%s:%s)", r.RecordId, r.Type, namesilo_api.DisplayHost(r.Host))
+	if err := dm.Api.DeleteDNSRecord(r); err != nil {
+		dm.deletes.giveBack()
+		return false, err
+	}
+	dm.managed.remove(r)
+	metrics.RecordChanges.WithLabelValues(metrics.ActionDeleted).Inc()
+	dm.recordEvent(object, apicorev1.EventTypeNormal, ReasonRecordDeleted, "Deleted record %s", describeRecord(&r))
+
+	return true, dm.autoupdateCache()
+}
+
+// TrackIngresses notes which existing Ingresses want records for each
+// hostname, without changing any, so that a shared record isn't deleted
+// along with one of them before the others have been handled. The oldest
+// Ingresses win any conflicts.
+func (dm *DnsManager) TrackIngresses(ingresses []*apinetworkingv1.Ingress) {
+	sorted := make([]*apinetworkingv1.Ingress, len(ingresses))
+	copy(sorted, ingresses)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreationTimestamp.Before(&sorted[j].CreationTimestamp)
+	})
+
+	for _, ingress := range sorted {
+		if !dm.ShouldProcessIngress(ingress) {
+			continue
+		}
+
+		if err := dm.trackSource(ingressSource(ingress)); err != nil {
+			log.Warn(err)
+		}
+	}
+}
+
+// trackSource notes the record src wants, and fails if another source
+// already wants something else for the same hostname.
+func (dm *DnsManager) trackSource(src recordSource) error {
+	// Records are compared without the public IP, which can change between
+	// calls.
+	record, err := dm.recordFromSource(src, "")
+	if err != nil {
+		return err
+	}
+
+	if owner, conflict := dm.claims.conflictsWith(*record); conflict {
+		return fmt.Errorf("%w: %s wants %s:%s, but %s already has a record there", ErrRecordConflict, src.description, record.Type, namesilo_api.DisplayHost(record.Host), owner)
+	}
+
+	if owner, conflict := dm.contributors.add(src.key, *record); conflict {
+		return fmt.Errorf("%w: %s wants %s:%s, but %s already has a different record there", ErrRecordConflict, src.description, record.Type, namesilo_api.DisplayHost(record.Host), describeContributor(owner))
+	}
+
+	return nil
+}
+
+// lockRecord holds the lock on the hostname of the record src wants until
+// unlock is called, so that nothing else changes the record in the meantime.
+// The cache is read once the lock is held, so that it includes any change
+// made by whoever held it last.
+func (dm *DnsManager) lockRecord(src recordSource) (*namesilo_api.ResourceRecord, *dnsManagerCache, func(), error) {
+	record, err := dm.recordFromSource(src, "")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	unlock := dm.hostLocks.Lock(record.Host)
+
+	cache := dm.snapshot()
+	record, err = dm.recordFromSource(src, cache.CurrentIpAddress)
+	if err != nil {
+		unlock()
+		return nil, nil, nil, err
+	}
+
+	return record, cache, unlock, nil
+}
+
+// snapshot returns a copy of the cache that can be read without holding the
+// lock.
+func (dm *DnsManager) snapshot() *dnsManagerCache {
+	dm.cacheLock.RLock()
+	defer dm.cacheLock.RUnlock()
+
+	records := make([]namesilo_api.ResourceRecord, len(dm.cache.CurrentRecords))
+	copy(records, dm.cache.CurrentRecords)
+
+	return &dnsManagerCache{records, dm.cache.CurrentIpAddress}
+}
+
+func (dm *DnsManager) observeIngressEvent(event string, ingress *apinetworkingv1.Ingress, handle func(*apinetworkingv1.Ingress) error) error {
+	if !dm.ShouldProcessIngress(ingress) {
+		// It may have been managed before its class changed.
+		dm.contributors.forget(ingressKey(ingress))
+
+		metrics.IngressEvents.WithLabelValues(event, metrics.ResultSkipped).Inc()
+		return nil
+	}
+
+	err := handle(ingress)
+
+	// Deleted Ingresses are gone, so there's nothing left to annotate.
+	if event == metrics.EventExists {
+		dm.annotateIngress(ingress, err)
+	}
+
+	if err != nil {
+		metrics.IngressEvents.WithLabelValues(event, metrics.ResultFailed).Inc()
+		dm.recordEvent(ingress, apicorev1.EventTypeWarning, ReasonRecordFailed, "Failed to sync DNS record: %s", err.Error())
+		return err
+	}
+
+	metrics.IngressEvents.WithLabelValues(event, metrics.ResultHandled).Inc()
+	return nil
 }
 
 func (dm *DnsManager) autoupdateCache() error {
@@ -143,26 +450,170 @@ func (dm *DnsManager) autoupdateCache() error {
 		return nil
 	}
 
-	return dm.UpdateCache()
+	// Errors are left for the caller to record, so they aren't counted twice.
+	if err := dm.updateCache(); err != nil {
+		return err
+	}
+
+	dm.status.recordSync()
+	return nil
 }
 
+// UpdateCache also starts a new sync, so MaxDeletesPerSync more records can
+// be deleted. Address records that can't be pointed at a new public IP don't
+// fail the refresh, which would only be retried in full; they're logged, and
+// tried again after the next one.
 func (dm *DnsManager) UpdateCache() error {
-	dm.cacheLock.Lock()
-	defer dm.cacheLock.Unlock()
+	if err := dm.updateCache(); err != nil {
+		return dm.status.recordError(err)
+	}
+
+	dm.status.recordSync()
+	dm.deletes.reset()
+	if err := dm.updateAddressRecords(); err != nil {
+		log.Error(dm.status.recordError(err))
+	}
+
+	return nil
+}
 
+// updateAddressRecords points the address records Ingresses want at the
+// current public IP, so that they follow it when it changes without waiting
+// for each Ingress to be handled again.
+func (dm *DnsManager) updateAddressRecords() error {
+	errs := []string{}
+	for _, host := range dm.contributors.addressHosts() {
+		if err := dm.updateAddressRecord(host); err != nil {
+			metrics.AddressRecordFailures.Inc()
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to update address records: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (dm *DnsManager) updateAddressRecord(host string) error {
+	unlock := dm.hostLocks.Lock(host)
+	defer unlock()
+
+	cache := dm.snapshot()
+	if cache.CurrentIpAddress == "" {
+		return nil
+	}
+
+	// When the public IP moves between IPv4 and IPv6, the record of the old
+	// type is stale, and is replaced with one of the new type.
+	record := namesilo_api.ResourceRecord{Type: addressRecordType(cache.CurrentIpAddress), Host: host, Value: cache.CurrentIpAddress, TTL: namesilo_api.DefaultTTL}
+	var current, stale *namesilo_api.ResourceRecord
+	for i, r := range cache.CurrentRecords {
+		if !isAddressRecord(r) || !record.SameHost(r) {
+			continue
+		}
+
+		if r.Type == record.Type {
+			current = &cache.CurrentRecords[i]
+		} else {
+			stale = &cache.CurrentRecords[i]
+		}
+	}
+
+	if current != nil && record.EqualsRecord(*current) && stale == nil {
+		return nil
+	}
+
+	if current == nil && stale == nil {
+		return nil
+	}
+
+	if dm.isProtected(host) || (current != nil && !dm.Policy.AllowsUpdate()) {
+		log.Debugf("Not updating record %s:%s to the new public IP", record.Type, namesilo_api.DisplayHost(host))
+		return nil
+	}
+
+	// The policy allows the record of the new type to be created, like it
+	// would be when its source is handled, even if the stale one stays.
+	if current == nil {
+		if err := dm.checkHalted(metrics.ActionCreated); err != nil {
+			return err
+		}
+
+		log.Infof("Replacing record %s:%s with %s:%s for new public IP %s", stale.Type, namesilo_api.DisplayHost(host), record.Type, namesilo_api.DisplayHost(host), record.Value)
+		if err := dm.Api.AddDNSRecord(record); err != nil {
+			return err
+		}
+		dm.managed.add(record, stale)
+		metrics.RecordChanges.WithLabelValues(metrics.ActionCreated).Inc()
+	} else if !record.EqualsRecord(*current) {
+		if err := dm.checkHalted(metrics.ActionUpdated); err != nil {
+			return err
+		}
+
+		record.RecordId = current.RecordId
+		log.Infof("Updating record %s:%s with new public IP %s", record.Type, namesilo_api.DisplayHost(host), record.Value)
+		if err := dm.Api.UpdateDNSRecord(record); err != nil {
+			return err
+		}
+		dm.managed.add(record, current)
+		metrics.RecordChanges.WithLabelValues(metrics.ActionUpdated).Inc()
+	}
+
+	// Deleting the stale record refreshes the cache along with it.
+	if stale != nil {
+		deleted, err := dm.deleteRecord(nil, *stale)
+		if err != nil || deleted {
+			return err
+		}
+	}
+
+	return dm.autoupdateCache()
+}
+
+func (dm *DnsManager) updateCache() error {
+	start := time.Now()
+	err := dm.refreshCache()
+	metrics.CacheRefreshDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.CacheRefreshFailures.Inc()
+	}
+
+	return err
+}
+
+// refreshCache fetches everything before taking the lock, so that events
+// aren't held up by slow requests. Results of a refresh that started before
+// the one already stored are dropped.
+func (dm *DnsManager) refreshCache() error {
+	generation := dm.refreshes.Add(1)
 	records, err := dm.Api.ListDNSRecords()
 	if err != nil {
 		return err
 	}
 
-	dm.cache.CurrentRecords = records
-	log.Debugf("Received %d records from Namesilo", len(dm.cache.CurrentRecords))
+	log.Debugf("Received %d records from Namesilo", len(records))
 
-	ip, err := icanhazip.GetPublicIP()
+	ip, err := dm.publicIp()
 	if err != nil {
 		return err
 	}
 
+	dm.cacheLock.Lock()
+	defer dm.cacheLock.Unlock()
+
+	if generation < dm.cacheGeneration {
+		log.Debugf("Dropping records from refresh %d; refresh %d is newer", generation, dm.cacheGeneration)
+		return nil
+	}
+	dm.cacheGeneration = generation
+
+	if ip != dm.cache.CurrentIpAddress {
+		metrics.SetPublicIP(ip)
+	}
+
+	dm.cache.CurrentRecords = records
 	dm.cache.CurrentIpAddress = ip
 
 	return nil
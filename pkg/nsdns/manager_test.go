@@ -1,17 +1,20 @@
 package nsdns
 
 import (
+	"fmt"
 	"os"
 	"testing"
 )
 
 import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	apinetworkingv1 "k8s.io/api/networking/v1"
 )
 
 import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
 	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
 )
 
@@ -39,6 +42,12 @@ func (nsapi *MockNamesiloApi) DeleteDNSRecord(rr namesilo_api.ResourceRecord) er
 	return args.Error(0)
 }
 
+func ingressWithClass(dm *DnsManager, host string) *apinetworkingv1.Ingress {
+	ingress := ingressWithHost(host)
+	ingress.Annotations = map[string]string{"kubernetes.io/ingress.class": dm.TargetIngressClass}
+	return ingress
+}
+
 func TestNewDnsManager(t *testing.T) {
 	ov := os.Getenv("NAMESILO_API_KEY")
 	os.Setenv("NAMESILO_API_KEY", "a")
@@ -196,3 +205,85 @@ func TestHandleIngressDeleted(t *testing.T) {
 
 	nsapi.AssertExpectations(t)
 }
+
+func TestHandleIngressExistsIgnoresHostCase(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("Example.com.", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", dm.BareDomainName)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	ingress := apinetworkingv1.Ingress{}
+	ingress.Annotations = map[string]string{}
+	ingress.Annotations["kubernetes.io/ingress.class"] = dm.TargetIngressClass
+	ingress.Spec.Rules = append(ingress.Spec.Rules, apinetworkingv1.IngressRule{})
+	ingress.Spec.Rules[0].Host = "Sub.Example.com."
+
+	dm.cache.CurrentRecords = append(dm.cache.CurrentRecords, namesilo_api.ResourceRecord{
+		RecordId: "1234",
+		Type:     "CNAME",
+		Host:     "sub.example.com",
+		Value:    "example.com",
+		TTL:      7207,
+		Distance: 0,
+	})
+
+	// No op; neither an add nor an update is expected.
+	err = dm.HandleIngressExists(&ingress)
+	assert.NoError(t, err)
+
+	nsapi.AssertExpectations(t)
+}
+
+func TestHandleIngressMetrics(t *testing.T) {
+	metrics.IngressEvents.Reset()
+	metrics.RecordChanges.Reset()
+
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	nsapi := MockNamesiloApi{}
+	dm.Api = &nsapi
+	dm.cache.CurrentIpAddress = "1.1.1.1"
+
+	ingress := ingressWithClass(dm, "sub.example.com")
+	nsapi.On("AddDNSRecord", mock.Anything).Return(nil).Once()
+	nsapi.On("AddDNSRecord", mock.Anything).Return(fmt.Errorf("namesilo is down")).Once()
+
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+	assert.Error(t, dm.HandleIngressExists(ingress))
+	assert.NoError(t, dm.HandleIngressExists(ingressWithHost("other.example.com")))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IngressEvents.WithLabelValues(metrics.EventExists, metrics.ResultHandled)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IngressEvents.WithLabelValues(metrics.EventExists, metrics.ResultFailed)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IngressEvents.WithLabelValues(metrics.EventExists, metrics.ResultSkipped)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RecordChanges.WithLabelValues(metrics.ActionCreated)))
+
+	nsapi.AssertExpectations(t)
+}
+
+func TestHandleIngressWildcardHost(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	wildcard := namedIngress(dm, "default", "apps", "*.apps.example.com")
+	specific := namedIngress(dm, "default", "web", "web.apps.example.com")
+	assert.NoError(t, dm.HandleIngressExists(wildcard))
+	assert.NoError(t, dm.HandleIngressExists(specific))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "*.apps.example.com", records[0].Host)
+	assert.Equal(t, "web.apps.example.com", records[1].Host)
+
+	// Neither record stands in for the other.
+	assert.NoError(t, dm.HandleIngressDeleted(specific))
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "*.apps.example.com", records[0].Host)
+
+	assert.NoError(t, dm.HandleIngressDeleted(wildcard))
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 0)
+}
@@ -0,0 +1,246 @@
+package nsdns
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// retryQueue hands keys to a pool of workers that sync them. Keys that fail
+// are retried with exponential backoff, up to MaxRetries times.
+type retryQueue struct {
+	// Names of what's being synced, for logs, like "ingress" and "ingresses".
+	item  string
+	items string
+
+	queue      workqueue.RateLimitingInterface
+	sync       func(key string) error
+	MaxRetries int
+
+	// Tracked so that work abandoned on shutdown can be reported.
+	pendingLock sync.Mutex
+	inFlight    map[string]bool
+	waiting     map[string]bool
+}
+
+func newRetryQueue(item, items string, rateLimiter workqueue.RateLimiter, sync func(key string) error) *retryQueue {
+	return &retryQueue{
+		item:       item,
+		items:      items,
+		queue:      workqueue.NewRateLimitingQueueWithConfig(rateLimiter, workqueue.RateLimitingQueueConfig{Name: items}),
+		sync:       sync,
+		MaxRetries: DefaultMaxRetries,
+		inFlight:   map[string]bool{},
+		waiting:    map[string]bool{},
+	}
+}
+
+// run syncs keys until ctx is cancelled. Once it is, run waits for each
+// worker to finish the key it's working on, and logs the ones that were still
+// waiting.
+func (q *retryQueue) run(ctx context.Context, workers int) {
+	log.Infof("Starting %d %s workers", workers, q.item)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, q.runWorker, time.Second)
+		}()
+	}
+
+	<-ctx.Done()
+	log.Infof("Stopping %s workers", q.item)
+	q.queue.ShutDown()
+	wg.Wait()
+
+	if abandoned := q.abandoned(); len(abandoned) != 0 {
+		log.Warnf("Abandoned %d pending %s: %s", len(abandoned), q.items, strings.Join(abandoned, ", "))
+	}
+}
+
+func (q *retryQueue) add(key string) {
+	q.queue.Add(key)
+}
+
+// InFlight lists the keys being worked on.
+func (q *retryQueue) InFlight() []string {
+	q.pendingLock.Lock()
+	defer q.pendingLock.Unlock()
+
+	return sortedKeys(q.inFlight)
+}
+
+// abandoned lists the keys that were queued, or waiting to be retried, when
+// the queue was shut down.
+func (q *retryQueue) abandoned() []string {
+	q.pendingLock.Lock()
+	defer q.pendingLock.Unlock()
+
+	keys := map[string]bool{}
+	for key := range q.waiting {
+		keys[key] = true
+	}
+
+	for {
+		item, shutdown := q.queue.Get()
+		if shutdown {
+			break
+		}
+
+		keys[item.(string)] = true
+		q.queue.Done(item)
+	}
+
+	return sortedKeys(keys)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	rv := []string{}
+	for key := range set {
+		rv = append(rv, key)
+	}
+
+	sort.Strings(rv)
+	return rv
+}
+
+func (q *retryQueue) runWorker(ctx context.Context) {
+	for q.processNextItem(ctx) {
+	}
+}
+
+func (q *retryQueue) processNextItem(ctx context.Context) bool {
+	// Once shutting down, the queue keeps handing out what's left in it;
+	// that's left in the queue for run to report instead.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(string)
+	if ctx.Err() != nil {
+		q.setPending(q.waiting, key, true)
+		return false
+	}
+
+	q.setPending(q.inFlight, key, true)
+	q.setPending(q.waiting, key, false)
+	err := q.sync(key)
+	q.setPending(q.inFlight, key, false)
+
+	if err == nil {
+		q.queue.Forget(item)
+		return true
+	}
+
+	if retries := q.queue.NumRequeues(item); retries < q.MaxRetries {
+		log.Errorf("Failed to sync %s %s, retrying (%d of %d): %s", q.item, key, retries+1, q.MaxRetries, err.Error())
+		q.setPending(q.waiting, key, true)
+		q.queue.AddRateLimited(item)
+		return true
+	}
+
+	log.Errorf("Giving up on %s %s after %d retries: %s", q.item, key, q.MaxRetries, err.Error())
+	q.queue.Forget(item)
+	return true
+}
+
+func (q *retryQueue) setPending(set map[string]bool, key string, pending bool) {
+	q.pendingLock.Lock()
+	defer q.pendingLock.Unlock()
+
+	if pending {
+		set[key] = true
+	} else {
+		delete(set, key)
+	}
+}
+
+// lastSeenObjects keeps the last version seen of each object queued by key.
+// Deleted objects are gone from their listers by the time their keys are
+// synced, so it's all that's left to find their records with.
+type lastSeenObjects struct {
+	lock    sync.Mutex
+	objects map[string]runtime.Object
+}
+
+func newLastSeenObjects() *lastSeenObjects {
+	return &lastSeenObjects{objects: map[string]runtime.Object{}}
+}
+
+// observe notes the object of an informer event, and returns its key.
+func (s *lastSeenObjects) observe(obj interface{}) (string, error) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return "", err
+	}
+
+	// If the watch missed the deletion, the last state known is all that's
+	// left.
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	if object, ok := obj.(runtime.Object); ok {
+		s.set(key, object)
+	}
+
+	return key, nil
+}
+
+func (s *lastSeenObjects) set(key string, obj runtime.Object) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.objects[key] = obj
+}
+
+func (s *lastSeenObjects) forget(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.objects, key)
+}
+
+// deleted handles the deletion of the object with key, given the last
+// version of it seen, and then forgets it. Objects that were never seen are
+// skipped.
+func (s *lastSeenObjects) deleted(key string, handle func(obj runtime.Object) error) error {
+	s.lock.Lock()
+	obj := s.objects[key]
+	s.lock.Unlock()
+
+	if obj == nil {
+		return nil
+	}
+
+	if err := handle(obj); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// It may have been recreated in the meantime.
+	if s.objects[key] == obj {
+		delete(s.objects, key)
+	}
+
+	return nil
+}
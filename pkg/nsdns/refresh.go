@@ -0,0 +1,64 @@
+package nsdns
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultRefreshInterval time.Duration = 1 * time.Hour
+const DefaultRefreshRetryInterval time.Duration = 5 * time.Minute
+
+// UpdateCacheWithRetry keeps trying to update the cache, waiting
+// retryInterval between attempts, until it succeeds or ctx is done.
+func (dm *DnsManager) UpdateCacheWithRetry(ctx context.Context, retryInterval time.Duration) error {
+	for {
+		err := dm.UpdateCache()
+		if err == nil {
+			return nil
+		}
+
+		log.Errorf("Cache update failed with %s. Retrying in %s...", err.Error(), retryInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// RefreshCachePeriodically updates the cache every interval, or whenever
+// something is sent on trigger, until ctx is done. The interval restarts
+// after each update.
+func (dm *DnsManager) RefreshCachePeriodically(ctx context.Context, interval, retryInterval time.Duration, trigger <-chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping cache refreshes")
+			return
+		case <-timer.C:
+			log.Debug("Refreshing cache")
+		case <-trigger:
+			log.Info("Refreshing cache on request")
+		}
+
+		if err := dm.UpdateCacheWithRetry(ctx, retryInterval); err != nil {
+			log.Info("Stopping cache refreshes")
+			return
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(interval)
+	}
+}
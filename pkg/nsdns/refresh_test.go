@@ -0,0 +1,96 @@
+package nsdns
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// flakyZone fails to list records until it's been asked a number of times.
+type flakyZone struct {
+	*fakeZone
+	failures int32
+	lists    int32
+}
+
+func (z *flakyZone) ListDNSRecords() ([]namesilo_api.ResourceRecord, error) {
+	if atomic.AddInt32(&z.lists, 1) <= atomic.LoadInt32(&z.failures) {
+		return nil, fmt.Errorf("namesilo is down")
+	}
+
+	return z.fakeZone.ListDNSRecords()
+}
+
+func TestUpdateCacheWithRetry(t *testing.T) {
+	dm, fake := testDnsManager(t)
+	zone := &flakyZone{fakeZone: fake, failures: 2}
+	dm.Api = zone
+	before := dm.LastSyncTime()
+
+	assert.NoError(t, dm.UpdateCacheWithRetry(context.Background(), time.Millisecond))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&zone.lists))
+	assert.True(t, dm.LastSyncTime().After(before))
+	assert.Len(t, dm.Status().LastErrors, 2)
+}
+
+func TestUpdateCacheWithRetryCancelled(t *testing.T) {
+	dm, fake := testDnsManager(t)
+	dm.Api = &flakyZone{fakeZone: fake, failures: 1000}
+	before := dm.LastSyncTime()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, dm.UpdateCacheWithRetry(ctx, time.Millisecond))
+	assert.Equal(t, before, dm.LastSyncTime())
+}
+
+func TestRefreshCachePeriodically(t *testing.T) {
+	dm, fake := testDnsManager(t)
+	zone := &flakyZone{fakeZone: fake}
+	dm.Api = zone
+
+	ctx, cancel := context.WithCancel(context.Background())
+	trigger := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		dm.RefreshCachePeriodically(ctx, time.Hour, time.Millisecond, trigger)
+		close(done)
+	}()
+
+	trigger <- struct{}{}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&zone.lists) == 1 }, time.Second, time.Millisecond)
+
+	trigger <- struct{}{}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&zone.lists) == 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("refresh loop didn't stop when cancelled")
+	}
+}
+
+func TestRefreshCachePeriodicallyInterval(t *testing.T) {
+	dm, fake := testDnsManager(t)
+	zone := &flakyZone{fakeZone: fake}
+	dm.Api = zone
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go dm.RefreshCachePeriodically(ctx, 5*time.Millisecond, time.Millisecond, nil)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&zone.lists) >= 3 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,121 @@
+package nsdns
+
+import (
+	"context"
+	"fmt"
+)
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RouteController handles one kind of Gateway API route, read through a
+// dynamic informer, the way IngressController handles Ingresses.
+type RouteController struct {
+	*retryQueue
+
+	dm       *DnsManager
+	kind     string
+	informer cache.SharedIndexInformer
+	lister   cache.GenericLister
+
+	lastSeen *lastSeenObjects
+}
+
+func NewRouteController(dm *DnsManager, kind string, informer informers.GenericInformer) *RouteController {
+	rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(DefaultRetryBaseDelay, DefaultRetryMaxDelay)
+	return newRouteController(dm, kind, informer, rateLimiter)
+}
+
+func newRouteController(dm *DnsManager, kind string, informer informers.GenericInformer, rateLimiter workqueue.RateLimiter) *RouteController {
+	c := &RouteController{
+		dm:       dm,
+		kind:     kind,
+		informer: informer.Informer(),
+		lister:   informer.Lister(),
+		lastSeen: newLastSeenObjects(),
+	}
+	c.retryQueue = newRetryQueue(kind, kind+"s", rateLimiter, c.sync)
+	return c
+}
+
+// Run handles events until ctx is cancelled, like IngressController.Run.
+func (c *RouteController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+
+	registration, err := c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			c.enqueue(new)
+		},
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.informer.RemoveEventHandler(registration)
+
+	objs, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	routes := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		if route, ok := obj.(*unstructured.Unstructured); ok {
+			routes = append(routes, route)
+		}
+	}
+	c.dm.TrackRoutes(routes)
+
+	c.run(ctx, workers)
+	return nil
+}
+
+func (c *RouteController) enqueue(obj interface{}) {
+	key, err := c.lastSeen.observe(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.add(key)
+}
+
+func (c *RouteController) sync(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	obj, err := c.lister.ByNamespace(namespace).Get(name)
+	if err == nil {
+		route, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return fmt.Errorf("unexpected %s object %T", c.kind, obj)
+		}
+
+		c.lastSeen.set(key, route)
+		return c.dm.HandleRouteExists(route)
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get %s %s: %w", c.kind, key, err)
+	}
+
+	return c.lastSeen.deleted(key, func(obj runtime.Object) error {
+		route, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return fmt.Errorf("unexpected %s object %T", c.kind, obj)
+		}
+
+		return c.dm.HandleRouteDeleted(route)
+	})
+}
@@ -0,0 +1,198 @@
+package nsdns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+)
+
+const GatewayAPIGroup string = "gateway.networking.k8s.io"
+
+// RouteResources are the Gateway API routes that records can be created for,
+// by kind.
+var RouteResources = map[string]schema.GroupVersionResource{
+	"HTTPRoute": {Group: GatewayAPIGroup, Version: "v1", Resource: "httproutes"},
+	"GRPCRoute": {Group: GatewayAPIGroup, Version: "v1", Resource: "grpcroutes"},
+	"TLSRoute":  {Group: GatewayAPIGroup, Version: "v1alpha2", Resource: "tlsroutes"},
+}
+
+var GatewayResource = schema.GroupVersionResource{Group: GatewayAPIGroup, Version: "v1", Resource: "gateways"}
+
+func ParseRouteKind(s string) (string, error) {
+	for kind := range RouteResources {
+		if strings.EqualFold(kind, s) {
+			return kind, nil
+		}
+	}
+
+	kinds := []string{}
+	for kind := range RouteResources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return "", fmt.Errorf("unsupported route kind %q; must be one of %s", s, strings.Join(kinds, ", "))
+}
+
+// RouteFilter picks the Gateway API routes that get records, by the Gateways
+// they're attached to, in place of an ingress class.
+type RouteFilter struct {
+	// Gateways are keyed by namespace/name.
+	Gateways       map[string]bool
+	GatewayClasses map[string]bool
+
+	// GatewayClassOf finds the class of a Gateway, which is needed to filter
+	// by GatewayClasses.
+	GatewayClassOf func(namespace, name string) (string, error)
+}
+
+// NewRouteFilter takes Gateways as namespace/name.
+func NewRouteFilter(gateways, gatewayClasses []string) (*RouteFilter, error) {
+	filter := &RouteFilter{Gateways: map[string]bool{}, GatewayClasses: map[string]bool{}}
+	for _, gateway := range gateways {
+		namespace, name, err := cache.SplitMetaNamespaceKey(gateway)
+		if err != nil || namespace == "" || name == "" {
+			return nil, fmt.Errorf("invalid gateway %q; must be namespace/name", gateway)
+		}
+
+		filter.Gateways[gateway] = true
+	}
+
+	for _, class := range gatewayClasses {
+		filter.GatewayClasses[class] = true
+	}
+
+	return filter, nil
+}
+
+// NewGatewayClassLookup finds the classes of Gateways in lister.
+func NewGatewayClassLookup(lister cache.GenericLister) func(namespace, name string) (string, error) {
+	return func(namespace, name string) (string, error) {
+		obj, err := lister.ByNamespace(namespace).Get(name)
+		if err != nil {
+			return "", err
+		}
+
+		gateway, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return "", fmt.Errorf("unexpected gateway object %T", obj)
+		}
+
+		class, _, err := unstructured.NestedString(gateway.Object, "spec", "gatewayClassName")
+		return class, err
+	}
+}
+
+// Matches reports whether the route is attached to one of the filter's
+// Gateways, or to a Gateway of one of its classes.
+func (f *RouteFilter) Matches(route *unstructured.Unstructured) bool {
+	refs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	for _, r := range refs {
+		ref, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		group, ok, _ := unstructured.NestedString(ref, "group")
+		if !ok {
+			group = GatewayAPIGroup
+		}
+
+		kind, ok, _ := unstructured.NestedString(ref, "kind")
+		if !ok {
+			kind = "Gateway"
+		}
+
+		if group != GatewayAPIGroup || kind != "Gateway" {
+			continue
+		}
+
+		namespace, ok, _ := unstructured.NestedString(ref, "namespace")
+		if !ok {
+			namespace = route.GetNamespace()
+		}
+
+		name, _, _ := unstructured.NestedString(ref, "name")
+		if f.Gateways[namespace+"/"+name] {
+			return true
+		}
+
+		if len(f.GatewayClasses) == 0 || f.GatewayClassOf == nil {
+			continue
+		}
+
+		class, err := f.GatewayClassOf(namespace, name)
+		if err != nil {
+			log.Debugf("Failed to find the class of gateway %s/%s: %s", namespace, name, err.Error())
+			continue
+		}
+
+		if f.GatewayClasses[class] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (dm *DnsManager) ShouldProcessRoute(route *unstructured.Unstructured) bool {
+	return dm.RouteFilter != nil && dm.RouteFilter.Matches(route)
+}
+
+func routeKey(route *unstructured.Unstructured) string {
+	return objectKey(route.GetKind(), route)
+}
+
+// routeSources wants a record for each of the route's hostnames. Routes
+// without any take theirs from their Gateways' listeners, which are left
+// alone.
+func routeSources(route *unstructured.Unstructured) []recordSource {
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+
+	rv := []recordSource{}
+	for _, host := range hostnames {
+		rv = append(rv, hostnameSource(routeKey(route), route, host, route.GetAnnotations()))
+	}
+
+	return rv
+}
+
+func (dm *DnsManager) HandleRouteExists(route *unstructured.Unstructured) error {
+	return dm.status.recordError(dm.observeResourceEvent(route.GetKind(), metrics.EventExists, route, dm.ShouldProcessRoute(route), routeKey(route), func() error {
+		return dm.handleSourcesExist(route, routeKey(route), routeSources(route))
+	}))
+}
+
+// HandleRouteDeleted skips the records of hostnames that are already gone.
+func (dm *DnsManager) HandleRouteDeleted(route *unstructured.Unstructured) error {
+	return dm.status.recordError(dm.observeResourceEvent(route.GetKind(), metrics.EventDeleted, route, dm.ShouldProcessRoute(route), routeKey(route), func() error {
+		return dm.handleSourcesDeleted(routeSources(route))
+	}))
+}
+
+// TrackRoutes notes which records existing routes want, like TrackIngresses.
+func (dm *DnsManager) TrackRoutes(routes []*unstructured.Unstructured) {
+	sorted := make([]*unstructured.Unstructured, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := sorted[i].GetCreationTimestamp(), sorted[j].GetCreationTimestamp()
+		return ti.Before(&tj)
+	})
+
+	for _, route := range sorted {
+		if dm.ShouldProcessRoute(route) {
+			dm.trackSources(routeSources(route))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package nsdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func httpRoute(namespace, name string, parentRefs []interface{}, hostnames ...interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": GatewayAPIGroup + "/v1",
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+		},
+		"spec": map[string]interface{}{
+			"parentRefs": parentRefs,
+			"hostnames":  hostnames,
+		},
+	}}
+}
+
+func gatewayRef(fields ...string) []interface{} {
+	ref := map[string]interface{}{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		ref[fields[i]] = fields[i+1]
+	}
+
+	return []interface{}{ref}
+}
+
+func TestParseRouteKind(t *testing.T) {
+	kind, err := ParseRouteKind("httproute")
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTPRoute", kind)
+
+	_, err = ParseRouteKind("UDPRoute")
+	assert.Equal(t, `unsupported route kind "UDPRoute"; must be one of GRPCRoute, HTTPRoute, TLSRoute`, err.Error())
+}
+
+func TestNewRouteFilter(t *testing.T) {
+	_, err := NewRouteFilter([]string{"public"}, nil)
+	assert.Equal(t, `invalid gateway "public"; must be namespace/name`, err.Error())
+}
+
+func TestRouteFilterMatches(t *testing.T) {
+	filter, err := NewRouteFilter([]string{"infra/public"}, []string{"external"})
+	assert.NoError(t, err)
+	filter.GatewayClassOf = func(namespace, name string) (string, error) {
+		if namespace == "team-a" && name == "edge" {
+			return "external", nil
+		}
+
+		return "", errors.New("not found")
+	}
+
+	var tests = []struct {
+		name     string
+		refs     []interface{}
+		expected bool
+	}{
+		{"Gateway", gatewayRef("namespace", "infra", "name", "public"), true},
+		{"GatewayExplicitKind", gatewayRef("group", GatewayAPIGroup, "kind", "Gateway", "namespace", "infra", "name", "public"), true},
+		{"GatewayOtherNamespace", gatewayRef("name", "public"), false},
+		{"GatewayClass", gatewayRef("name", "edge"), true},
+		{"OtherGateway", gatewayRef("namespace", "infra", "name", "private"), false},
+		{"Service", gatewayRef("group", "", "kind", "Service", "namespace", "infra", "name", "public"), false},
+		{"NoParents", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := httpRoute("team-a", "web", tt.refs, "sub.example.com")
+			assert.Equal(t, tt.expected, filter.Matches(route))
+		})
+	}
+}
+
+// publicRoutes matches the routes attached to the infra/public Gateway.
+var publicRoutes, _ = NewRouteFilter([]string{"infra/public"}, nil)
+
+func TestHandleRoute(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.RouteFilter = publicRoutes
+
+	route := httpRoute("team-a", "web", gatewayRef("namespace", "infra", "name", "public"), "a.example.com", "b.example.com")
+	assert.NoError(t, dm.HandleRouteExists(route))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "a.example.com", records[0].Host)
+	assert.Equal(t, "b.example.com", records[1].Host)
+
+	// An Ingress can't take over a hostname the route already has.
+	ingress := namedIngress(dm, "team-b", "web", "a.example.com")
+	ingress.Annotations[CNAMEFlatteningAnnotation] = "true"
+	err := dm.HandleIngressExists(ingress)
+	assert.ErrorIs(t, err, ErrRecordConflict)
+	assert.Equal(t, "conflicting record: ingress team-b/web wants A:a.example.com, but HTTPRoute team-a/web (a.example.com) already has a different record there", err.Error())
+
+	// The Ingress still wants a record there, once the route is gone.
+	assert.NoError(t, dm.HandleRouteDeleted(route))
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "a.example.com", records[0].Host)
+}
+
+func TestHandleRouteUnmatched(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.RouteFilter = publicRoutes
+
+	route := httpRoute("team-a", "web", gatewayRef("namespace", "infra", "name", "private"), "a.example.com")
+	assert.NoError(t, dm.HandleRouteExists(route))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 0)
+}
+
+func TestHandleRouteHostnameRemoved(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.RouteFilter = publicRoutes
+	parents := gatewayRef("namespace", "infra", "name", "public")
+
+	assert.NoError(t, dm.HandleRouteExists(httpRoute("team-a", "web", parents, "a.example.com", "b.example.com", "c.example.com")))
+	assert.NoError(t, dm.HandleIngressExists(ingressWithClass(dm, "c.example.com")))
+	assert.NoError(t, dm.HandleRouteExists(httpRoute("team-a", "web", parents, "a.example.com")))
+
+	// The removed hostname's record is deleted, unless something else still
+	// wants it.
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "a.example.com", records[0].Host)
+	assert.Equal(t, "c.example.com", records[1].Host)
+
+	// And the route no longer has a say in it.
+	_, conflict := dm.contributors.add("team-b/web", cnameRecord("b.example.com", "elsewhere.com"))
+	assert.False(t, conflict)
+}
+
+func TestRouteController(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.RouteFilter = publicRoutes
+
+	gvr := RouteResources["HTTPRoute"]
+	route := httpRoute("team-a", "web", gatewayRef("namespace", "infra", "name", "public"), "a.example.com")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "HTTPRouteList"}, route)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	controller := newRouteController(dm, "HTTPRoute", factory.ForResource(gvr), workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	go controller.Run(ctx, 2)
+
+	assert.Eventually(t, func() bool {
+		records, _ := zone.ListDNSRecords()
+		return len(records) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err := client.Resource(gvr).Namespace("team-a").Delete(context.Background(), "web", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		records, _ := zone.ListDNSRecords()
+		return len(records) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
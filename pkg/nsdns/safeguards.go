@@ -0,0 +1,145 @@
+package nsdns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// Policy limits the changes nsdns is allowed to make to records.
+type Policy string
+
+const (
+	// PolicySync creates, updates, and deletes records.
+	PolicySync Policy = "sync"
+	// PolicyUpsertOnly creates and updates records, but never deletes them.
+	PolicyUpsertOnly Policy = "upsert-only"
+	// PolicyCreateOnly only creates records that don't exist yet.
+	PolicyCreateOnly Policy = "create-only"
+)
+
+var Policies []Policy = []Policy{PolicySync, PolicyUpsertOnly, PolicyCreateOnly}
+
+// ErrTooManyDeletes is returned once MaxDeletesPerSync records have been
+// deleted since the cache was last refreshed, for the delete that would go
+// over, and for every change after it until the next refresh.
+var ErrTooManyDeletes = errors.New("too many deletes")
+
+// ErrRecordBlocked is returned when the Policy, or a protected host, keeps a
+// DNSRecord's record from being changed to what it asks for.
+var ErrRecordBlocked = errors.New("record change blocked")
+
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range Policies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+
+	names := []string{}
+	for _, p := range Policies {
+		names = append(names, string(p))
+	}
+
+	return "", fmt.Errorf("unsupported policy %q; must be one of %s", s, strings.Join(names, ", "))
+}
+
+func (p Policy) AllowsUpdate() bool {
+	return p != PolicyCreateOnly
+}
+
+func (p Policy) AllowsDelete() bool {
+	return p == PolicySync
+}
+
+// SetProtectedHosts sets the hostnames whose records are never updated or
+// deleted. Hostnames outside of the domain are taken to be relative to it,
+// and "@" is the domain itself.
+func (dm *DnsManager) SetProtectedHosts(hosts []string) error {
+	protected := map[string]bool{}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+
+		rr := namesilo_api.ResourceRecord{Host: host}
+		fqdn, err := namesilo_api.CanonicalHost(rr.FQDN(dm.BareDomainName))
+		if err != nil {
+			return err
+		}
+
+		protected[fqdn] = true
+	}
+
+	dm.protectedHosts = protected
+	return nil
+}
+
+func (dm *DnsManager) isProtected(host string) bool {
+	return dm.protectedHosts[host]
+}
+
+// deleteBudget counts deletes between cache refreshes. Once a delete would
+// go over, the budget is exceeded, and stays that way until it's reset.
+type deleteBudget struct {
+	lock     sync.Mutex
+	deletes  int
+	exceeded bool
+}
+
+// take uses up one delete, unless max have already been used. A max of 0
+// allows any number.
+func (b *deleteBudget) take(max int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if max > 0 && b.deletes >= max {
+		b.exceeded = true
+		return false
+	}
+
+	b.deletes++
+	return true
+}
+
+// giveBack returns a delete that didn't happen.
+func (b *deleteBudget) giveBack() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.deletes--
+}
+
+func (b *deleteBudget) isExceeded() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.exceeded
+}
+
+func (b *deleteBudget) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.deletes = 0
+	b.exceeded = false
+}
+
+// checkHalted fails once MaxDeletesPerSync has been exceeded, since that many
+// deletes is more likely to be a mistake than not, and no more changes of
+// any kind are made until the next sync.
+func (dm *DnsManager) checkHalted(action string) error {
+	if !dm.deletes.isExceeded() {
+		return nil
+	}
+
+	metrics.RecordChangesBlocked.WithLabelValues(action, metrics.ReasonMaxDeletes).Inc()
+	return fmt.Errorf("%w: changes are halted until the next sync, after trying to delete more than %d records", ErrTooManyDeletes, dm.MaxDeletesPerSync)
+}
@@ -0,0 +1,134 @@
+package nsdns
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range Policies {
+		parsed, err := ParsePolicy(string(p))
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+
+	_, err := ParsePolicy("delete-everything")
+	assert.Error(t, err)
+
+	assert.True(t, PolicySync.AllowsUpdate())
+	assert.True(t, PolicySync.AllowsDelete())
+	assert.True(t, PolicyUpsertOnly.AllowsUpdate())
+	assert.False(t, PolicyUpsertOnly.AllowsDelete())
+	assert.False(t, PolicyCreateOnly.AllowsUpdate())
+	assert.False(t, PolicyCreateOnly.AllowsDelete())
+}
+
+func TestSetProtectedHosts(t *testing.T) {
+	dm, err := NewDnsManagerWithApiKey("example.com", "b", "c")
+	assert.NoError(t, err)
+
+	assert.NoError(t, dm.SetProtectedHosts([]string{"@", "www", "Mail.Example.com.", ""}))
+	assert.True(t, dm.isProtected("example.com"))
+	assert.True(t, dm.isProtected("www.example.com"))
+	assert.True(t, dm.isProtected("mail.example.com"))
+	assert.False(t, dm.isProtected("sub.example.com"))
+}
+
+func TestPolicyCreateOnly(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.Policy = PolicyCreateOnly
+
+	assert.NoError(t, zone.AddDNSRecord(namesilo_api.ResourceRecord{Type: "CNAME", Host: "sub.example.com", Value: "other.example.com", TTL: 7207}))
+	assert.NoError(t, dm.UpdateCache())
+
+	// The stale record is left alone, but new records are still created.
+	assert.NoError(t, dm.HandleIngressExists(ingressWithClass(dm, "sub.example.com")))
+	assert.NoError(t, dm.HandleIngressExists(ingressWithClass(dm, "new.example.com")))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "other.example.com", records[0].Value)
+	assert.Equal(t, "new.example.com", records[1].Host)
+
+	assert.NoError(t, dm.HandleIngressDeleted(ingressWithClass(dm, "new.example.com")))
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+}
+
+func TestPolicyUpsertOnly(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.Policy = PolicyUpsertOnly
+
+	assert.NoError(t, zone.AddDNSRecord(cnameRecord("sub.example.com", "example.com")))
+	assert.NoError(t, dm.UpdateCache())
+
+	assert.NoError(t, dm.HandleIngressDeleted(ingressWithClass(dm, "sub.example.com")))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+}
+
+func TestProtectedHosts(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	assert.NoError(t, dm.SetProtectedHosts([]string{"www"}))
+
+	assert.NoError(t, zone.AddDNSRecord(namesilo_api.ResourceRecord{Type: "CNAME", Host: "www.example.com", Value: "other.example.com", TTL: 7207}))
+	assert.NoError(t, dm.UpdateCache())
+
+	ingress := ingressWithClass(dm, "www.example.com")
+	assert.NoError(t, dm.HandleIngressExists(ingress))
+	assert.NoError(t, dm.HandleIngressDeleted(ingress))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "other.example.com", records[0].Value)
+}
+
+func TestMaxDeletesPerSync(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.MaxDeletesPerSync = 2
+
+	for _, host := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		assert.NoError(t, zone.AddDNSRecord(cnameRecord(host, "example.com")))
+	}
+	assert.NoError(t, dm.UpdateCache())
+
+	assert.NoError(t, dm.HandleIngressDeleted(ingressWithClass(dm, "a.example.com")))
+	assert.NoError(t, dm.HandleIngressDeleted(ingressWithClass(dm, "b.example.com")))
+
+	recorder := record.NewFakeRecorder(10)
+	dm.Recorder = recorder
+
+	err := dm.HandleIngressDeleted(ingressWithClass(dm, "c.example.com"))
+	assert.True(t, errors.Is(err, ErrTooManyDeletes))
+	assert.Contains(t, <-recorder.Events, "Warning ChangesHalted Not deleting record CNAME c.example.com")
+
+	// Every other change is halted too, and the manager isn't ready.
+	err = dm.HandleIngressExists(ingressWithClass(dm, "d.example.com"))
+	assert.True(t, errors.Is(err, ErrTooManyDeletes))
+	assert.EqualError(t, dm.Ready(func() bool { return true }, time.Hour), "changes are halted until the next sync, after trying to delete more than 2 records")
+	assert.Len(t, dm.Status().LastErrors, 2)
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+
+	// The next sync allows more changes.
+	assert.NoError(t, dm.UpdateCache())
+	assert.NoError(t, dm.Ready(func() bool { return true }, time.Hour))
+	assert.NoError(t, dm.HandleIngressDeleted(ingressWithClass(dm, "c.example.com")))
+	assert.NoError(t, dm.HandleIngressExists(ingressWithClass(dm, "d.example.com")))
+
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "d.example.com", records[0].Host)
+}
@@ -0,0 +1,108 @@
+package nsdns
+
+import (
+	"context"
+	"fmt"
+)
+
+import (
+	apicorev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ServiceController handles Services of type LoadBalancer, the way
+// IngressController handles Ingresses.
+type ServiceController struct {
+	*retryQueue
+
+	dm       *DnsManager
+	informer cache.SharedIndexInformer
+	lister   corelisters.ServiceLister
+
+	lastSeen *lastSeenObjects
+}
+
+func NewServiceController(dm *DnsManager, informer coreinformers.ServiceInformer) *ServiceController {
+	rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(DefaultRetryBaseDelay, DefaultRetryMaxDelay)
+	return newServiceController(dm, informer, rateLimiter)
+}
+
+func newServiceController(dm *DnsManager, informer coreinformers.ServiceInformer, rateLimiter workqueue.RateLimiter) *ServiceController {
+	c := &ServiceController{
+		dm:       dm,
+		informer: informer.Informer(),
+		lister:   informer.Lister(),
+		lastSeen: newLastSeenObjects(),
+	}
+	c.retryQueue = newRetryQueue("service", "services", rateLimiter, c.sync)
+	return c
+}
+
+// Run handles events until ctx is cancelled, like IngressController.Run.
+func (c *ServiceController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+
+	registration, err := c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			c.enqueue(new)
+		},
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.informer.RemoveEventHandler(registration)
+
+	services, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	c.dm.TrackServices(services)
+
+	c.run(ctx, workers)
+	return nil
+}
+
+func (c *ServiceController) enqueue(obj interface{}) {
+	key, err := c.lastSeen.observe(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.add(key)
+}
+
+func (c *ServiceController) sync(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	service, err := c.lister.Services(namespace).Get(name)
+	if err == nil {
+		c.lastSeen.set(key, service)
+		return c.dm.HandleServiceExists(service)
+	}
+
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get service %s: %w", key, err)
+	}
+
+	return c.lastSeen.deleted(key, func(obj runtime.Object) error {
+		service, ok := obj.(*apicorev1.Service)
+		if !ok {
+			return fmt.Errorf("unexpected service object %T", obj)
+		}
+
+		return c.dm.HandleServiceDeleted(service)
+	})
+}
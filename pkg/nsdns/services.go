@@ -0,0 +1,146 @@
+package nsdns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+)
+
+// ServiceHostnameAnnotation opts a Service of type LoadBalancer in to getting
+// records, for each of the comma-separated hostnames in its value.
+const ServiceHostnameAnnotation string = "nsdns.io/hostname"
+
+// ServiceTargetAnnotation picks what a Service's records point at; one of
+// ServiceTargetLoadBalancer, the default, or ServiceTargetPublicIP.
+const ServiceTargetAnnotation string = "nsdns.io/target"
+
+const (
+	// ServiceTargetLoadBalancer points records at the first address in the
+	// Service's load balancer status; an address record for an IP, or a CNAME
+	// for a hostname.
+	ServiceTargetLoadBalancer string = "load-balancer"
+
+	// ServiceTargetPublicIP gives the Service the same records as an Ingress.
+	ServiceTargetPublicIP string = "public-ip"
+)
+
+const serviceKind string = "Service"
+
+// ShouldProcessService reports whether the Service is a load balancer with
+// hostnames to create records for.
+func (dm *DnsManager) ShouldProcessService(service *apicorev1.Service) bool {
+	if service.Spec.Type != apicorev1.ServiceTypeLoadBalancer {
+		return false
+	}
+
+	return len(serviceHostnames(service)) != 0
+}
+
+func serviceKey(service *apicorev1.Service) string {
+	return objectKey(serviceKind, service)
+}
+
+func serviceHostnames(service *apicorev1.Service) []string {
+	rv := []string{}
+	for _, host := range strings.Split(service.Annotations[ServiceHostnameAnnotation], ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			rv = append(rv, host)
+		}
+	}
+
+	return rv
+}
+
+// serviceSources wants a record for each of the Service's hostnames. A
+// Service that's waiting on its load balancer's address wants none yet;
+// another event comes along once it has one.
+func serviceSources(service *apicorev1.Service) ([]recordSource, error) {
+	value := ""
+	switch target := service.Annotations[ServiceTargetAnnotation]; target {
+	case "", ServiceTargetLoadBalancer:
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				value = ingress.IP
+				break
+			}
+
+			if ingress.Hostname != "" {
+				value = ingress.Hostname
+				break
+			}
+		}
+
+		if value == "" {
+			log.Debugf("%s has no load balancer address yet", serviceKey(service))
+			return nil, nil
+		}
+	case ServiceTargetPublicIP:
+	default:
+		return nil, fmt.Errorf("invalid %s annotation %q on %s; must be %s or %s", ServiceTargetAnnotation, target, serviceKey(service), ServiceTargetLoadBalancer, ServiceTargetPublicIP)
+	}
+
+	rv := []recordSource{}
+	for _, host := range serviceHostnames(service) {
+		src := hostnameSource(serviceKey(service), service, host, service.Annotations)
+		src.value = value
+		rv = append(rv, src)
+	}
+
+	return rv, nil
+}
+
+func (dm *DnsManager) HandleServiceExists(service *apicorev1.Service) error {
+	return dm.status.recordError(dm.observeResourceEvent(serviceKind, metrics.EventExists, service, dm.ShouldProcessService(service), serviceKey(service), func() error {
+		sources, err := serviceSources(service)
+		if err != nil {
+			return err
+		}
+
+		return dm.handleSourcesExist(service, serviceKey(service), sources)
+	}))
+}
+
+// HandleServiceDeleted skips the records of hostnames that are already gone.
+func (dm *DnsManager) HandleServiceDeleted(service *apicorev1.Service) error {
+	return dm.status.recordError(dm.observeResourceEvent(serviceKind, metrics.EventDeleted, service, dm.ShouldProcessService(service), serviceKey(service), func() error {
+		sources, err := serviceSources(service)
+		if err != nil {
+			return err
+		}
+
+		return dm.handleSourcesDeleted(sources)
+	}))
+}
+
+// TrackServices notes which records existing Services want, like
+// TrackIngresses.
+func (dm *DnsManager) TrackServices(services []*apicorev1.Service) {
+	sorted := make([]*apicorev1.Service, len(services))
+	copy(sorted, services)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreationTimestamp.Before(&sorted[j].CreationTimestamp)
+	})
+
+	for _, service := range sorted {
+		if !dm.ShouldProcessService(service) {
+			continue
+		}
+
+		sources, err := serviceSources(service)
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+
+		dm.trackSources(sources)
+	}
+}
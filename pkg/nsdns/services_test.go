@@ -0,0 +1,189 @@
+package nsdns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func loadBalancerService(namespace, name, hostnames string, ingress ...apicorev1.LoadBalancerIngress) *apicorev1.Service {
+	return &apicorev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Annotations: map[string]string{ServiceHostnameAnnotation: hostnames},
+		},
+		Spec: apicorev1.ServiceSpec{
+			Type: apicorev1.ServiceTypeLoadBalancer,
+		},
+		Status: apicorev1.ServiceStatus{
+			LoadBalancer: apicorev1.LoadBalancerStatus{Ingress: ingress},
+		},
+	}
+}
+
+func TestHandleServiceExists(t *testing.T) {
+	var tests = []struct {
+		name     string
+		target   string
+		ingress  []apicorev1.LoadBalancerIngress
+		expected []string
+	}{
+		{"IP", "", []apicorev1.LoadBalancerIngress{{IP: "192.168.1.10"}}, []string{"A:mqtt.example.com:192.168.1.10"}},
+		{"IPv6", ServiceTargetLoadBalancer, []apicorev1.LoadBalancerIngress{{IP: "2001:db8::10"}}, []string{"AAAA:mqtt.example.com:2001:db8::10"}},
+		{"Hostname", "", []apicorev1.LoadBalancerIngress{{Hostname: "lb.cloud.com"}}, []string{"CNAME:mqtt.example.com:lb.cloud.com"}},
+		{"Pending", "", nil, []string{}},
+		{"PublicIP", ServiceTargetPublicIP, nil, []string{"CNAME:mqtt.example.com:example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+
+			service := loadBalancerService("default", "mqtt", "mqtt.example.com", tt.ingress...)
+			if tt.target != "" {
+				service.Annotations[ServiceTargetAnnotation] = tt.target
+			}
+			assert.NoError(t, dm.HandleServiceExists(service))
+
+			records, _ := zone.ListDNSRecords()
+			actual := []string{}
+			for _, r := range records {
+				actual = append(actual, string(r.Type)+":"+r.Host+":"+r.Value)
+			}
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestHandleServiceExistsSkipped(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	service := loadBalancerService("default", "mqtt", "mqtt.example.com", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+	service.Spec.Type = apicorev1.ServiceTypeClusterIP
+	assert.NoError(t, dm.HandleServiceExists(service))
+
+	service = loadBalancerService("default", "mqtt", " , ", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+	assert.NoError(t, dm.HandleServiceExists(service))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 0)
+}
+
+func TestHandleServiceExistsInvalidTarget(t *testing.T) {
+	dm, _ := testDnsManager(t)
+
+	service := loadBalancerService("default", "mqtt", "mqtt.example.com")
+	service.Annotations[ServiceTargetAnnotation] = "node"
+	err := dm.HandleServiceExists(service)
+	assert.Equal(t, `invalid nsdns.io/target annotation "node" on Service default/mqtt; must be load-balancer or public-ip`, err.Error())
+}
+
+func TestHandleServiceMultipleHostnames(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	service := loadBalancerService("default", "mqtt", "mqtt.example.com, broker.example.com", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+	assert.NoError(t, dm.HandleServiceExists(service))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+
+	assert.NoError(t, dm.HandleServiceDeleted(service))
+	records, _ = zone.ListDNSRecords()
+	assert.Len(t, records, 0)
+}
+
+func TestHandleServiceHostnameRemoved(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	service := loadBalancerService("default", "mqtt", "mqtt.example.com, broker.example.com", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+	assert.NoError(t, dm.HandleServiceExists(service))
+
+	service.Annotations[ServiceHostnameAnnotation] = "mqtt.example.com"
+	assert.NoError(t, dm.HandleServiceExists(service))
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "mqtt.example.com", records[0].Host)
+}
+
+func TestHandleServiceNoLongerManaged(t *testing.T) {
+	var tests = []struct {
+		name   string
+		change func(service *apicorev1.Service)
+	}{
+		{"AnnotationRemoved", func(service *apicorev1.Service) { delete(service.Annotations, ServiceHostnameAnnotation) }},
+		{"ClusterIP", func(service *apicorev1.Service) { service.Spec.Type = apicorev1.ServiceTypeClusterIP }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+
+			service := loadBalancerService("default", "mqtt", "mqtt.example.com, broker.example.com", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+			assert.NoError(t, dm.HandleServiceExists(service))
+
+			tt.change(service)
+			assert.NoError(t, dm.HandleServiceExists(service))
+
+			records, _ := zone.ListDNSRecords()
+			assert.Len(t, records, 0)
+		})
+	}
+}
+
+func TestUpdateAddressRecordsSkipsLoadBalancers(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.FlattensCNAMEs = true
+
+	assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "sub", "sub.example.com")))
+	service := loadBalancerService("default", "mqtt", "mqtt.example.com", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+	assert.NoError(t, dm.HandleServiceExists(service))
+
+	dm.publicIp = func() (string, error) { return "2.2.2.2", nil }
+	assert.NoError(t, dm.UpdateCache())
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "sub.example.com", records[0].Host)
+	assert.Equal(t, "2.2.2.2", records[0].Value)
+	assert.Equal(t, "mqtt.example.com", records[1].Host)
+	assert.Equal(t, "192.168.1.10", records[1].Value)
+}
+
+func TestServiceController(t *testing.T) {
+	dm, zone := testDnsManager(t)
+
+	service := loadBalancerService("default", "mqtt", "mqtt.example.com", apicorev1.LoadBalancerIngress{IP: "192.168.1.10"})
+	clientset := fake.NewSimpleClientset(service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	controller := newServiceController(dm, factory.Core().V1().Services(), workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	go controller.Run(ctx, 2)
+
+	assert.Eventually(t, func() bool {
+		records, _ := zone.ListDNSRecords()
+		return len(records) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err := clientset.CoreV1().Services("default").Delete(context.Background(), "mqtt", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		records, _ := zone.ListDNSRecords()
+		return len(records) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
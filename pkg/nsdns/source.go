@@ -0,0 +1,200 @@
+package nsdns
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+import (
+	log "github.com/sirupsen/logrus"
+	apicorev1 "k8s.io/api/core/v1"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// recordSource is an object that wants a record for one of its hostnames,
+// like an Ingress.
+type recordSource struct {
+	object      runtime.Object
+	key         string
+	description string
+	host        string
+	annotations map[string]string
+
+	// value is what the record points at, in place of the domain or public
+	// IP, when set. Addresses get address records, and hostnames CNAMEs.
+	value string
+}
+
+// ingressSource wants a record for the host of the first rule of ingress.
+func ingressSource(ingress *apinetworkingv1.Ingress) recordSource {
+	return recordSource{
+		object:      ingress,
+		key:         ingressKey(ingress),
+		description: "ingress " + ingressKey(ingress),
+		host:        ingress.Spec.Rules[0].Host,
+		annotations: ingress.Annotations,
+	}
+}
+
+func ingressKey(ingress *apinetworkingv1.Ingress) string {
+	return ingress.Namespace + "/" + ingress.Name
+}
+
+// describeContributor describes the source that a key of recordContributors
+// belongs to. Ingresses are keyed by namespace/name alone; other sources'
+// keys describe themselves.
+func describeContributor(key string) string {
+	if strings.Contains(key, " ") {
+		return key
+	}
+
+	return "ingress " + key
+}
+
+// objectKey identifies objects other than Ingresses, which can want records
+// for several hostnames, as "Kind namespace/name".
+func objectKey(kind string, object metav1.Object) string {
+	return kind + " " + object.GetNamespace() + "/" + object.GetName()
+}
+
+// hostnameSource wants a record for one of the hostnames of the object with
+// key.
+func hostnameSource(key string, object runtime.Object, host string, annotations map[string]string) recordSource {
+	key = fmt.Sprintf("%s (%s)", key, host)
+	return recordSource{
+		object:      object,
+		key:         key,
+		description: key,
+		host:        host,
+		annotations: annotations,
+	}
+}
+
+// handleSourcesExist handles each of the sources of object, which has key,
+// and deletes the records of hostnames it no longer has, unless other sources
+// still want them.
+func (dm *DnsManager) handleSourcesExist(object runtime.Object, key string, sources []recordSource) error {
+	keys := map[string]bool{}
+	for _, src := range sources {
+		keys[src.key] = true
+	}
+
+	errs := []error{}
+	if err := dm.handleHostnamesDropped(object, dm.contributors.retain(key+" (", keys)); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, src := range sources {
+		if err := dm.handleRecordExists(src); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+// handleHostnamesDropped deletes the records that were wanted by the sources
+// of object with the keys in dropped, for hostnames it no longer has, skipping
+// the records that are already gone.
+func (dm *DnsManager) handleHostnamesDropped(object runtime.Object, dropped map[string]namesilo_api.ResourceRecord) error {
+	keys := make([]string, 0, len(dropped))
+	for key := range dropped {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := []error{}
+	for _, key := range keys {
+		err := dm.handleHostnameDropped(object, key, dropped[key])
+		if errors.Is(err, ErrRecordNotFound) {
+			log.Debugf("Record of %s is already gone", key)
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+// handleSourcesDeleted skips the records that are already gone.
+func (dm *DnsManager) handleSourcesDeleted(sources []recordSource) error {
+	errs := []error{}
+	for _, src := range sources {
+		err := dm.handleRecordDeleted(src)
+		if errors.Is(err, ErrRecordNotFound) {
+			log.Debugf("Record of %s is already gone", src.description)
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+func (dm *DnsManager) trackSources(sources []recordSource) {
+	for _, src := range sources {
+		if err := dm.trackSource(src); err != nil {
+			log.Warn(err)
+		}
+	}
+}
+
+// observeResourceEvent is observeIngressEvent, for the object of kind with
+// key.
+func (dm *DnsManager) observeResourceEvent(kind, event string, object runtime.Object, managed bool, key string, handle func() error) error {
+	if !managed {
+		// It may have been managed before it changed, and its records go
+		// along with it.
+		handle = func() error {
+			return dm.handleHostnamesDropped(object, dm.contributors.retain(key+" (", nil))
+		}
+	}
+
+	if err := handle(); err != nil {
+		metrics.ResourceEvents.WithLabelValues(kind, event, metrics.ResultFailed).Inc()
+		dm.recordEvent(object, apicorev1.EventTypeWarning, ReasonRecordFailed, "Failed to sync DNS record: %s", err.Error())
+		return err
+	}
+
+	result := metrics.ResultHandled
+	if !managed {
+		result = metrics.ResultSkipped
+	}
+
+	metrics.ResourceEvents.WithLabelValues(kind, event, result).Inc()
+	return nil
+}
+
+// combineErrors keeps the first of errs wrapped, so that it can still be
+// checked for with errors.Is, and mentions the rest.
+func combineErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	others := []string{}
+	for _, err := range errs[1:] {
+		others = append(others, err.Error())
+	}
+
+	return fmt.Errorf("%w; %s", errs[0], strings.Join(others, "; "))
+}
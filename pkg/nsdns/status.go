@@ -0,0 +1,110 @@
+package nsdns
+
+import (
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+)
+
+const maxRecentErrors int = 10
+
+type StatusError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type DnsManagerStatus struct {
+	CurrentIpAddress string        `json:"currentIpAddress"`
+	RecordCount      int           `json:"recordCount"`
+	LastSyncTime     *time.Time    `json:"lastSyncTime"`
+	LastErrors       []StatusError `json:"lastErrors"`
+	Standby          bool          `json:"standby"`
+}
+
+type dnsManagerStatus struct {
+	lock       sync.Mutex
+	lastSync   time.Time
+	lastErrors []StatusError
+	standby    bool
+}
+
+func newDnsManagerStatus() *dnsManagerStatus {
+	return &dnsManagerStatus{lastErrors: []StatusError{}}
+}
+
+func (s *dnsManagerStatus) recordSync() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastSync = time.Now()
+	metrics.LastSuccessfulSync.Set(float64(s.lastSync.Unix()))
+}
+
+// recordError keeps track of the most recent errors, and returns err so that
+// it can wrap return statements.
+func (s *dnsManagerStatus) recordError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastErrors = append(s.lastErrors, StatusError{time.Now(), err.Error()})
+	if len(s.lastErrors) > maxRecentErrors {
+		s.lastErrors = s.lastErrors[len(s.lastErrors)-maxRecentErrors:]
+	}
+
+	return err
+}
+
+// LastSyncTime returns when the cache was last successfully refreshed, or the
+// zero time if it never has been.
+func (dm *DnsManager) LastSyncTime() time.Time {
+	dm.status.lock.Lock()
+	defer dm.status.lock.Unlock()
+
+	return dm.status.lastSync
+}
+
+// SetStandby marks the manager as waiting to become the leader, during which
+// it doesn't keep its cache up to date.
+func (dm *DnsManager) SetStandby(standby bool) {
+	dm.status.lock.Lock()
+	defer dm.status.lock.Unlock()
+
+	dm.status.standby = standby
+}
+
+func (dm *DnsManager) Standby() bool {
+	dm.status.lock.Lock()
+	defer dm.status.lock.Unlock()
+
+	return dm.status.standby
+}
+
+func (dm *DnsManager) Status() DnsManagerStatus {
+	dm.cacheLock.RLock()
+	rv := DnsManagerStatus{
+		CurrentIpAddress: dm.cache.CurrentIpAddress,
+		RecordCount:      len(dm.cache.CurrentRecords),
+	}
+	dm.cacheLock.RUnlock()
+
+	dm.status.lock.Lock()
+	defer dm.status.lock.Unlock()
+
+	if !dm.status.lastSync.IsZero() {
+		lastSync := dm.status.lastSync
+		rv.LastSyncTime = &lastSync
+	}
+
+	rv.LastErrors = make([]StatusError, len(dm.status.lastErrors))
+	copy(rv.LastErrors, dm.status.lastErrors)
+	rv.Standby = dm.status.standby
+
+	return rv
+}
@@ -1,5 +1,11 @@
 package nsdns
 
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
 import (
 	networkingv1 "k8s.io/api/networking/v1"
 )
@@ -8,18 +14,86 @@ import (
 	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
 )
 
-func NamesiloRecordFromIngress(ingress *networkingv1.Ingress, domainName, ip string) (*namesilo_api.ResourceRecord, error) {
+// CNAMEFlatteningAnnotation overrides, per Ingress, whether its host gets an
+// address record instead of a CNAME. Its value is parsed as a boolean.
+const CNAMEFlatteningAnnotation string = "nsdns.io/cname-flattening"
+
+// NamesiloRecordFromIngress builds the record the ingress wants. The domain
+// itself gets an address record pointing at ip, as do other hosts when
+// flattensCNAMEs is set, unless overridden by the ingress's annotation;
+// other hosts get a CNAME to the domain.
+func NamesiloRecordFromIngress(ingress *networkingv1.Ingress, domainName, ip string, flattensCNAMEs bool) (*namesilo_api.ResourceRecord, error) {
+	return namesiloRecordForHost(ingressSource(ingress), domainName, ip, flattensCNAMEs)
+}
+
+func namesiloRecordForHost(src recordSource, domainName, ip string, flattensCNAMEs bool) (*namesilo_api.ResourceRecord, error) {
+	host, err := namesilo_api.CanonicalHost(src.host)
+	if err != nil {
+		return nil, err
+	}
+
+	domainName, err = namesilo_api.CanonicalHost(domainName)
+	if err != nil {
+		return nil, err
+	}
+
+	if value, ok := src.annotations[CNAMEFlatteningAnnotation]; ok {
+		flattensCNAMEs, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation %q on %s", CNAMEFlatteningAnnotation, value, src.description)
+		}
+	}
+
 	rr := namesilo_api.ResourceRecord{}
-	rr.Host = ingress.Spec.Rules[0].Host
-	rr.TTL = 7207
+	rr.Host = host
+	rr.TTL = namesilo_api.DefaultTTL
 
-	if rr.Host == domainName {
-		rr.Type = "A"
+	if src.value != "" {
+		return recordForValue(rr, src)
+	}
+
+	if rr.Host == domainName || flattensCNAMEs {
+		rr.Type = addressRecordType(ip)
 		rr.Value = ip
 	} else {
-		rr.Type = "CNAME"
+		rr.Type = namesilo_api.RecordTypeCNAME
 		rr.Value = domainName
 	}
 
 	return &rr, nil
 }
+
+func recordForValue(rr namesilo_api.ResourceRecord, src recordSource) (*namesilo_api.ResourceRecord, error) {
+	if net.ParseIP(src.value) != nil {
+		rr.Type = addressRecordType(src.value)
+		rr.Value = src.value
+		return &rr, nil
+	}
+
+	value, err := namesilo_api.CanonicalHost(src.value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q of %s: %w", src.value, src.description, err)
+	}
+
+	rr.Type = namesilo_api.RecordTypeCNAME
+	rr.Value = value
+	return &rr, nil
+}
+
+// addressRecordType is AAAA for IPv6 addresses, and A for anything else,
+// including an unknown address.
+func addressRecordType(ip string) namesilo_api.RecordType {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return namesilo_api.RecordTypeAAAA
+	}
+
+	return namesilo_api.RecordTypeA
+}
+
+func isAddressRecord(rr namesilo_api.ResourceRecord) bool {
+	return rr.Type == namesilo_api.RecordTypeA || rr.Type == namesilo_api.RecordTypeAAAA
+}
+
+func (dm *DnsManager) recordFromSource(src recordSource, ip string) (*namesilo_api.ResourceRecord, error) {
+	return namesiloRecordForHost(src, dm.BareDomainName, ip, dm.FlattensCNAMEs)
+}
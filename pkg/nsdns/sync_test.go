@@ -0,0 +1,188 @@
+package nsdns
+
+import (
+	"errors"
+	"testing"
+)
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	apinetworkingv1 "k8s.io/api/networking/v1"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/metrics"
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func ingressWithHost(host string) *apinetworkingv1.Ingress {
+	ingress := apinetworkingv1.Ingress{}
+	ingress.Spec.Rules = append(ingress.Spec.Rules, apinetworkingv1.IngressRule{})
+	ingress.Spec.Rules[0].Host = host
+	return &ingress
+}
+
+func TestNamesiloRecordFromIngress(t *testing.T) {
+	var tests = []struct {
+		name     string
+		host     string
+		expected *namesilo_api.ResourceRecord
+		errorMsg string
+	}{
+		{"Apex", "example.com", &namesilo_api.ResourceRecord{Type: "A", Host: "example.com", Value: "1.1.1.1", TTL: 7207}, ""},
+		{"Subdomain", "sub.example.com", &namesilo_api.ResourceRecord{Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}, ""},
+		{"Uppercase", "SUB.Example.com", &namesilo_api.ResourceRecord{Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}, ""},
+		{"Unicode", "café.example.com", &namesilo_api.ResourceRecord{Type: "CNAME", Host: "xn--caf-dma.example.com", Value: "example.com", TTL: 7207}, ""},
+		{"Punycode", "xn--caf-dma.example.com", &namesilo_api.ResourceRecord{Type: "CNAME", Host: "xn--caf-dma.example.com", Value: "example.com", TTL: 7207}, ""},
+		{"Wildcard", "*.apps.example.com", &namesilo_api.ResourceRecord{Type: "CNAME", Host: "*.apps.example.com", Value: "example.com", TTL: 7207}, ""},
+		{"WildcardNotLeftmost", "apps.*.example.com", nil, `invalid hostname "apps.*.example.com": a wildcard must be the whole leftmost label`},
+		{"MixedScript", "раypal.example.com", nil, `invalid hostname "раypal.example.com": label "раypal" mixes Cyrillic and Latin scripts`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, err := NamesiloRecordFromIngress(ingressWithHost(tt.host), "example.com", "1.1.1.1", false)
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, rr)
+			} else {
+				assert.Nil(t, rr)
+				assert.Equal(t, tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestNamesiloRecordFromIngressFlattened(t *testing.T) {
+	var tests = []struct {
+		name        string
+		host        string
+		ip          string
+		flattens    bool
+		annotations map[string]string
+		expected    *namesilo_api.ResourceRecord
+		errorMsg    string
+	}{
+		{"Flattened", "sub.example.com", "1.1.1.1", true, nil, &namesilo_api.ResourceRecord{Type: "A", Host: "sub.example.com", Value: "1.1.1.1", TTL: 7207}, ""},
+		{"FlattenedIPv6", "sub.example.com", "2001:db8::1", true, nil, &namesilo_api.ResourceRecord{Type: "AAAA", Host: "sub.example.com", Value: "2001:db8::1", TTL: 7207}, ""},
+		{"ApexIPv6", "example.com", "2001:db8::1", false, nil, &namesilo_api.ResourceRecord{Type: "AAAA", Host: "example.com", Value: "2001:db8::1", TTL: 7207}, ""},
+		{"Annotated", "sub.example.com", "1.1.1.1", false, map[string]string{CNAMEFlatteningAnnotation: "true"}, &namesilo_api.ResourceRecord{Type: "A", Host: "sub.example.com", Value: "1.1.1.1", TTL: 7207}, ""},
+		{"AnnotatedOff", "sub.example.com", "1.1.1.1", true, map[string]string{CNAMEFlatteningAnnotation: "false"}, &namesilo_api.ResourceRecord{Type: "CNAME", Host: "sub.example.com", Value: "example.com", TTL: 7207}, ""},
+		{"AnnotatedInvalid", "sub.example.com", "1.1.1.1", false, map[string]string{CNAMEFlatteningAnnotation: "sometimes"}, nil, `invalid nsdns.io/cname-flattening annotation "sometimes" on ingress default/web`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := ingressWithHost(tt.host)
+			ingress.Namespace = "default"
+			ingress.Name = "web"
+			ingress.Annotations = tt.annotations
+
+			rr, err := NamesiloRecordFromIngress(ingress, "example.com", tt.ip, tt.flattens)
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, rr)
+			} else {
+				assert.Nil(t, rr)
+				assert.Equal(t, tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestUpdateAddressRecords(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.FlattensCNAMEs = true
+
+	assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "apex", "example.com")))
+	assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "sub", "sub.example.com")))
+
+	// Records nsdns doesn't manage are left alone.
+	assert.NoError(t, zone.AddDNSRecord(namesilo_api.ResourceRecord{Type: "A", Host: "other.example.com", Value: "1.1.1.1", TTL: 7207}))
+
+	dm.publicIp = func() (string, error) { return "2.2.2.2", nil }
+	assert.NoError(t, dm.UpdateCache())
+
+	records, _ := zone.ListDNSRecords()
+	assert.Len(t, records, 3)
+	assert.Equal(t, "2.2.2.2", records[0].Value)
+	assert.Equal(t, "2.2.2.2", records[1].Value)
+	assert.Equal(t, "1.1.1.1", records[2].Value)
+}
+
+// brokenHostZone fails to update the records of one host.
+type brokenHostZone struct {
+	*fakeZone
+	host string
+}
+
+func (z brokenHostZone) UpdateDNSRecord(rr namesilo_api.ResourceRecord) error {
+	if rr.Host == z.host {
+		return errors.New("namesilo is broken")
+	}
+
+	return z.fakeZone.UpdateDNSRecord(rr)
+}
+
+func TestUpdateAddressRecordsFailure(t *testing.T) {
+	dm, zone := testDnsManager(t)
+	dm.FlattensCNAMEs = true
+	dm.Api = brokenHostZone{zone, "example.com"}
+
+	assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "apex", "example.com")))
+	assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "sub", "sub.example.com")))
+
+	// The refresh itself succeeded, so it isn't failed by the one record that
+	// couldn't be updated.
+	failures := testutil.ToFloat64(metrics.AddressRecordFailures)
+	dm.publicIp = func() (string, error) { return "2.2.2.2", nil }
+	assert.NoError(t, dm.UpdateCache())
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.AddressRecordFailures))
+
+	lastErrors := dm.Status().LastErrors
+	assert.Len(t, lastErrors, 1)
+	assert.Contains(t, lastErrors[0].Message, "namesilo is broken")
+
+	records, _ := zone.ListDNSRecords()
+	assert.Equal(t, "1.1.1.1", records[0].Value)
+	assert.Equal(t, "2.2.2.2", records[1].Value)
+}
+
+func TestUpdateAddressRecordsAddressFamilyChanged(t *testing.T) {
+	var tests = []struct {
+		name     string
+		policy   Policy
+		expected []namesilo_api.RecordType
+	}{
+		{"Sync", PolicySync, []namesilo_api.RecordType{"AAAA"}},
+		{"UpsertOnly", PolicyUpsertOnly, []namesilo_api.RecordType{"A", "AAAA"}},
+		{"CreateOnly", PolicyCreateOnly, []namesilo_api.RecordType{"A", "AAAA"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, zone := testDnsManager(t)
+			dm.FlattensCNAMEs = true
+			dm.Policy = tt.policy
+
+			assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "sub", "sub.example.com")))
+
+			dm.publicIp = func() (string, error) { return "2001:db8::1", nil }
+			assert.NoError(t, dm.UpdateCache())
+			assert.Len(t, dm.Status().LastErrors, 0)
+
+			records, _ := zone.ListDNSRecords()
+			types := []namesilo_api.RecordType{}
+			for _, r := range records {
+				types = append(types, r.Type)
+				if r.Type == namesilo_api.RecordTypeAAAA {
+					assert.Equal(t, "2001:db8::1", r.Value)
+				}
+			}
+			assert.Equal(t, tt.expected, types)
+
+			// Handling the Ingress again finds the new record.
+			assert.NoError(t, dm.HandleIngressExists(namedIngress(dm, "default", "sub", "sub.example.com")))
+			records, _ = zone.ListDNSRecords()
+			assert.Len(t, records, len(tt.expected))
+		})
+	}
+}
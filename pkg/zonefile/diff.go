@@ -0,0 +1,133 @@
+package zonefile
+
+import (
+	"fmt"
+	"io"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// Plan is the set of changes needed to bring a live zone in line with a
+// desired set of records.
+type Plan struct {
+	Add       []namesilo_api.ResourceRecord
+	Update    []namesilo_api.ResourceRecord
+	Delete    []namesilo_api.ResourceRecord
+	Unchanged int
+}
+
+// Diff compares the live zone against the desired records.
+// Desired records that already exist are left alone. Remaining records of the
+// same type and host are updated in place, rather than deleted and re-added,
+// and anything left over is added. Live records that the desired set doesn't
+// account for are only deleted when prune is set.
+func Diff(live, desired []namesilo_api.ResourceRecord, prune bool) Plan {
+	plan := Plan{}
+	matched := make([]bool, len(live))
+	unmatched := []namesilo_api.ResourceRecord{}
+
+	for _, d := range desired {
+		found := false
+		for i, l := range live {
+			if !matched[i] && l.EqualsRecord(d) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+
+		if found {
+			plan.Unchanged += 1
+		} else {
+			unmatched = append(unmatched, d)
+		}
+	}
+
+	for _, d := range unmatched {
+		found := false
+		for i, l := range live {
+			if !matched[i] && l.SameTypeAndHost(d) {
+				matched[i] = true
+				found = true
+				d.RecordId = l.RecordId
+				plan.Update = append(plan.Update, d)
+				break
+			}
+		}
+
+		if !found {
+			plan.Add = append(plan.Add, d)
+		}
+	}
+
+	if prune {
+		for i, l := range live {
+			if !matched[i] {
+				plan.Delete = append(plan.Delete, l)
+			}
+		}
+	}
+
+	return plan
+}
+
+func (p Plan) IsEmpty() bool {
+	return len(p.Add) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// Apply makes the planned changes. Deletions happen before additions, so that
+// a record can be replaced by one of a type that can't coexist with it.
+func (p Plan) Apply(api namesilo_api.NamesiloApi) error {
+	for _, rr := range p.Update {
+		if err := api.UpdateDNSRecord(rr); err != nil {
+			return err
+		}
+	}
+
+	for _, rr := range p.Delete {
+		if err := api.DeleteDNSRecord(rr); err != nil {
+			return err
+		}
+	}
+
+	for _, rr := range p.Add {
+		if err := api.AddDNSRecord(rr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write describes the plan, one change per line.
+func (p Plan) Write(w io.Writer) error {
+	changes := []struct {
+		prefix  string
+		records []namesilo_api.ResourceRecord
+	}{
+		{"+", p.Add},
+		{"~", p.Update},
+		{"-", p.Delete},
+	}
+
+	for _, c := range changes {
+		for _, rr := range c.records {
+			if _, err := fmt.Fprintf(w, "%s %s %s %d %s\n", c.prefix, rr.Type, namesilo_api.DisplayHost(rr.Host), rr.TTL, formatValue(rr)); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d to add, %d to update, %d to delete, %d unchanged\n", len(p.Add), len(p.Update), len(p.Delete), p.Unchanged)
+	return err
+}
+
+func formatValue(rr namesilo_api.ResourceRecord) string {
+	if rr.Type == namesilo_api.RecordTypeMX || rr.Type == namesilo_api.RecordTypeSRV {
+		return fmt.Sprintf("%d %s", rr.Distance, rr.Value)
+	}
+
+	return rr.Value
+}
@@ -0,0 +1,108 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+type recordingApi struct {
+	calls []string
+	err   error
+}
+
+func (api *recordingApi) ListDNSRecords() ([]namesilo_api.ResourceRecord, error) {
+	return nil, api.err
+}
+
+func (api *recordingApi) UpdateDNSRecord(rr namesilo_api.ResourceRecord) error {
+	api.calls = append(api.calls, "update "+rr.RecordId)
+	return api.err
+}
+
+func (api *recordingApi) AddDNSRecord(rr namesilo_api.ResourceRecord) error {
+	api.calls = append(api.calls, "add "+rr.Host)
+	return api.err
+}
+
+func (api *recordingApi) DeleteDNSRecord(rr namesilo_api.ResourceRecord) error {
+	api.calls = append(api.calls, "delete "+rr.RecordId)
+	return api.err
+}
+
+var liveRecords = []namesilo_api.ResourceRecord{
+	{RecordId: "1", Type: "A", Host: "example.com", Value: "1.2.3.4", TTL: 7207},
+	{RecordId: "2", Type: "CNAME", Host: "www.example.com", Value: "example.com", TTL: 7207},
+	{RecordId: "3", Type: "MX", Host: "example.com", Value: "mail1.example.com", TTL: 3600, Distance: 10},
+	{RecordId: "4", Type: "MX", Host: "example.com", Value: "mail2.example.com", TTL: 3600, Distance: 20},
+	{RecordId: "5", Type: "TXT", Host: "old.example.com", Value: "stale", TTL: 3600},
+}
+
+var desiredRecords = []namesilo_api.ResourceRecord{
+	{Type: "A", Host: "example.com", Value: "5.6.7.8", TTL: 7207},
+	{Type: "CNAME", Host: "WWW.example.com.", Value: "example.com", TTL: 7207},
+	{Type: "MX", Host: "example.com", Value: "mail2.example.com", TTL: 3600, Distance: 20},
+	{Type: "TXT", Host: "new.example.com", Value: "fresh", TTL: 3600},
+}
+
+func TestDiff(t *testing.T) {
+	plan := Diff(liveRecords, desiredRecords, false)
+
+	updated := desiredRecords[0]
+	updated.RecordId = "1"
+
+	assert.Equal(t, []namesilo_api.ResourceRecord{desiredRecords[3]}, plan.Add)
+	assert.Equal(t, []namesilo_api.ResourceRecord{updated}, plan.Update)
+	assert.Empty(t, plan.Delete)
+	assert.Equal(t, 2, plan.Unchanged)
+	assert.False(t, plan.IsEmpty())
+}
+
+func TestDiffPrune(t *testing.T) {
+	plan := Diff(liveRecords, desiredRecords, true)
+
+	assert.Equal(t, 1, len(plan.Add))
+	assert.Equal(t, 1, len(plan.Update))
+	assert.Equal(t, []namesilo_api.ResourceRecord{liveRecords[2], liveRecords[4]}, plan.Delete)
+	assert.Equal(t, 2, plan.Unchanged)
+}
+
+func TestDiffNoChanges(t *testing.T) {
+	plan := Diff(liveRecords, liveRecords, true)
+	assert.True(t, plan.IsEmpty())
+	assert.Equal(t, len(liveRecords), plan.Unchanged)
+}
+
+func TestPlanApply(t *testing.T) {
+	api := recordingApi{}
+	plan := Diff(liveRecords, desiredRecords, true)
+
+	assert.NoError(t, plan.Apply(&api))
+	assert.Equal(t, []string{"update 1", "delete 3", "delete 5", "add new.example.com"}, api.calls)
+
+	api = recordingApi{err: errors.New("failed")}
+	assert.Equal(t, "failed", plan.Apply(&api).Error())
+	assert.Equal(t, []string{"update 1"}, api.calls)
+}
+
+func TestPlanWrite(t *testing.T) {
+	plan := Diff(liveRecords, desiredRecords, true)
+
+	var buf bytes.Buffer
+	assert.NoError(t, plan.Write(&buf))
+
+	expected := "+ TXT new.example.com 3600 fresh\n" +
+		"~ A example.com 7207 5.6.7.8\n" +
+		"- MX example.com 3600 10 mail1.example.com\n" +
+		"- TXT old.example.com 3600 stale\n" +
+		"1 to add, 1 to update, 2 to delete, 2 unchanged\n"
+	assert.Equal(t, expected, buf.String())
+}
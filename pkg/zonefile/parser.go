@@ -0,0 +1,343 @@
+package zonefile
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// entry is a single logical line of a master file, after comments have been
+// removed and parenthesized groups have been joined.
+type entry struct {
+	line          int
+	tokens        []token
+	inheritsOwner bool
+}
+
+// Parse reads an RFC 1035 master file into the records it describes.
+// Records are returned with fully qualified hosts, in the same form that
+// ListDNSRecords returns them. SOA records are skipped, since Namesilo manages
+// those itself.
+func Parse(r io.Reader, zone string) ([]namesilo_api.ResourceRecord, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	zone, err = namesilo_api.CanonicalHost(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := tokenize(string(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	origin := zone
+	ttl := -1
+	owner := ""
+	records := []namesilo_api.ResourceRecord{}
+
+	for _, e := range entries {
+		first := e.tokens[0]
+		if !first.quoted && strings.HasPrefix(first.text, "$") {
+			switch strings.ToUpper(first.text) {
+			case "$ORIGIN":
+				if len(e.tokens) != 2 {
+					return nil, fmt.Errorf("line %d: $ORIGIN takes exactly one name", e.line)
+				}
+				origin, err = resolveName(e.tokens[1].text, origin)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", e.line, err.Error())
+				}
+			case "$TTL":
+				if len(e.tokens) != 2 {
+					return nil, fmt.Errorf("line %d: $TTL takes exactly one value", e.line)
+				}
+				ttl, err = parseTTL(e.tokens[1].text)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", e.line, err.Error())
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unsupported directive %s", e.line, first.text)
+			}
+			continue
+		}
+
+		tokens := e.tokens
+		if !e.inheritsOwner {
+			owner, err = resolveName(tokens[0].text, origin)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", e.line, err.Error())
+			}
+			tokens = tokens[1:]
+		} else if owner == "" {
+			return nil, fmt.Errorf("line %d: record has no owner name", e.line)
+		}
+
+		rr := namesilo_api.ResourceRecord{Host: owner, TTL: ttl}
+
+		// TTL and class may appear in either order before the type.
+		for len(tokens) > 0 {
+			if strings.EqualFold(tokens[0].text, "IN") {
+				tokens = tokens[1:]
+			} else if t, err := parseTTL(tokens[0].text); err == nil {
+				rr.TTL = t
+				tokens = tokens[1:]
+			} else {
+				break
+			}
+		}
+
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("line %d: record has no type", e.line)
+		}
+
+		if strings.EqualFold(tokens[0].text, "SOA") {
+			continue
+		}
+
+		rr.Type, err = namesilo_api.ParseRecordType(tokens[0].text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", e.line, err.Error())
+		}
+
+		if rr.TTL < 0 {
+			rr.TTL = namesilo_api.DefaultTTL
+		}
+
+		if err := parseRData(&rr, tokens[1:], origin); err != nil {
+			return nil, fmt.Errorf("line %d: %s", e.line, err.Error())
+		}
+
+		if rr.Host != zone && !strings.HasSuffix(rr.Host, "."+zone) {
+			return nil, fmt.Errorf("line %d: %s is outside of zone %s", e.line, rr.Host, zone)
+		}
+
+		records = append(records, rr)
+	}
+
+	return records, nil
+}
+
+func parseRData(rr *namesilo_api.ResourceRecord, rdata []token, origin string) error {
+	expectFields := func(n int, form string) error {
+		if len(rdata) != n {
+			return fmt.Errorf("%s record must be in the form %q", rr.Type, form)
+		}
+		return nil
+	}
+
+	var err error
+	switch rr.Type {
+	case namesilo_api.RecordTypeA, namesilo_api.RecordTypeAAAA:
+		if err := expectFields(1, "address"); err != nil {
+			return err
+		}
+		rr.Value = rdata[0].text
+	case namesilo_api.RecordTypeCNAME, namesilo_api.RecordTypeNS:
+		if err := expectFields(1, "name"); err != nil {
+			return err
+		}
+		rr.Value, err = resolveName(rdata[0].text, origin)
+	case namesilo_api.RecordTypeMX:
+		if err := expectFields(2, "preference exchange"); err != nil {
+			return err
+		}
+		if rr.Distance, err = parseUint16(rdata[0].text); err != nil {
+			return err
+		}
+		rr.Value, err = resolveName(rdata[1].text, origin)
+	case namesilo_api.RecordTypeSRV:
+		if err := expectFields(4, "priority weight port target"); err != nil {
+			return err
+		}
+		if rr.Distance, err = parseUint16(rdata[0].text); err != nil {
+			return err
+		}
+		target := rdata[3].text
+		if target != "." {
+			if target, err = resolveName(target, origin); err != nil {
+				return err
+			}
+		}
+		rr.Value = fmt.Sprintf("%s %s %s", rdata[1].text, rdata[2].text, target)
+	case namesilo_api.RecordTypeTXT:
+		if len(rdata) == 0 {
+			return fmt.Errorf("TXT record must have at least one string")
+		}
+		parts := []string{}
+		for _, t := range rdata {
+			parts = append(parts, t.text)
+		}
+		rr.Value = strings.Join(parts, "")
+	case namesilo_api.RecordTypeCAA:
+		if err := expectFields(3, "flags tag value"); err != nil {
+			return err
+		}
+		rr.Value = fmt.Sprintf("%s %s \"%s\"", rdata[0].text, rdata[1].text, rdata[2].text)
+	}
+
+	return err
+}
+
+// resolveName converts a name from the file into a canonical, fully qualified
+// host, relative to origin unless it ends in a dot.
+func resolveName(name, origin string) (string, error) {
+	if name == "@" {
+		return origin, nil
+	}
+
+	if !strings.HasSuffix(name, ".") {
+		name = name + "." + origin
+	}
+
+	return namesilo_api.CanonicalHost(name)
+}
+
+var ttlUnits = map[byte]int{
+	's': 1,
+	'm': 60,
+	'h': 60 * 60,
+	'd': 24 * 60 * 60,
+	'w': 7 * 24 * 60 * 60,
+}
+
+// parseTTL accepts plain seconds, or BIND style durations like 1h30m.
+func parseTTL(s string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty ttl")
+	}
+
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return n, nil
+	}
+
+	total, current := 0, -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			if current < 0 {
+				current = 0
+			}
+			current = current*10 + int(c-'0')
+			continue
+		}
+
+		unit, ok := ttlUnits[c|0x20]
+		if !ok || current < 0 {
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+
+		total += current * unit
+		current = -1
+	}
+
+	if current >= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+
+	return total, nil
+}
+
+func parseUint16(s string) (int, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%q must be a number between 0 and 65535", s)
+	}
+
+	return int(n), nil
+}
+
+// tokenize splits a master file into entries, handling comments, quoted
+// strings, and parentheses that continue an entry across lines.
+func tokenize(contents string) ([]entry, error) {
+	entries := []entry{}
+	line := 1
+	depth := 0
+	var current *entry
+
+	flush := func() {
+		if current != nil && len(current.tokens) > 0 {
+			entries = append(entries, *current)
+		}
+		current = nil
+	}
+
+	startLine := true
+	for i := 0; i < len(contents); {
+		c := contents[i]
+
+		if current == nil {
+			current = &entry{line: line, inheritsOwner: startLine && (c == ' ' || c == '\t')}
+		}
+		startLine = false
+
+		switch {
+		case c == '\n':
+			line += 1
+			i += 1
+			startLine = true
+			if depth == 0 {
+				flush()
+			}
+		case c == ' ' || c == '\t' || c == '\r':
+			i += 1
+		case c == ';':
+			for i < len(contents) && contents[i] != '\n' {
+				i += 1
+			}
+		case c == '(':
+			depth += 1
+			i += 1
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: unbalanced parentheses", line)
+			}
+			depth -= 1
+			i += 1
+		case c == '"':
+			var sb strings.Builder
+			i += 1
+			for {
+				if i >= len(contents) || contents[i] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+				}
+				if contents[i] == '"' {
+					i += 1
+					break
+				}
+				if contents[i] == '\\' && i+1 < len(contents) {
+					i += 1
+				}
+				sb.WriteByte(contents[i])
+				i += 1
+			}
+			current.tokens = append(current.tokens, token{sb.String(), true})
+		default:
+			start := i
+			for i < len(contents) && !strings.ContainsRune(" \t\r\n;()\"", rune(contents[i])) {
+				i += 1
+			}
+			current.tokens = append(current.tokens, token{contents[start:i], false})
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("line %d: unbalanced parentheses", line)
+	}
+
+	flush()
+	return entries, nil
+}
@@ -0,0 +1,123 @@
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func TestParse(t *testing.T) {
+	zone := `; Backup of example.com
+$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1.example.com. admin.example.com. (
+		2023010101 ; serial
+		7200 3600 1209600 3600 )
+@		7207	IN	A	1.2.3.4
+		IN	3600	MX	10 mail
+		MX	20 mail2.example.net.
+www	CNAME	@
+_sip._tcp	SRV	10 5 5060 sip
+sip	AAAA	2001:db8::1
+@	TXT	"v=spf1 include:\"quoted\" -all" ; trailing comment
+long	TXT	( "first part "
+		"second part" )
+@	CAA	0 issue "letsencrypt.org"
+$ORIGIN sub.example.com.
+café	7207	A	5.6.7.8
+`
+
+	expected := []namesilo_api.ResourceRecord{
+		{Type: "A", Host: "example.com", Value: "1.2.3.4", TTL: 7207},
+		{Type: "MX", Host: "example.com", Value: "mail.example.com", TTL: 3600, Distance: 10},
+		{Type: "MX", Host: "example.com", Value: "mail2.example.net", TTL: 3600, Distance: 20},
+		{Type: "CNAME", Host: "www.example.com", Value: "example.com", TTL: 3600},
+		{Type: "SRV", Host: "_sip._tcp.example.com", Value: "5 5060 sip.example.com", TTL: 3600, Distance: 10},
+		{Type: "AAAA", Host: "sip.example.com", Value: "2001:db8::1", TTL: 3600},
+		{Type: "TXT", Host: "example.com", Value: `v=spf1 include:"quoted" -all`, TTL: 3600},
+		{Type: "TXT", Host: "long.example.com", Value: "first part second part", TTL: 3600},
+		{Type: "CAA", Host: "example.com", Value: `0 issue "letsencrypt.org"`, TTL: 3600},
+		{Type: "A", Host: "xn--caf-dma.sub.example.com", Value: "5.6.7.8", TTL: 7207},
+	}
+
+	records, err := Parse(strings.NewReader(zone), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, records)
+}
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		errorMsg string
+	}{
+		{"UnsupportedType", "@ 3600 PTR example.com.", "line 1: unsupported record type: PTR"},
+		{"UnsupportedDirective", "$INCLUDE other.db", "line 1: unsupported directive $INCLUDE"},
+		{"NoOwner", " 3600 A 1.2.3.4", "line 1: record has no owner name"},
+		{"NoType", "@ 3600 IN", "line 1: record has no type"},
+		{"OutsideZone", "@ A 1.2.3.4\nother.com. A 1.2.3.4", "line 2: other.com is outside of zone example.com"},
+		{"BadMX", "@ MX mail.example.com.", `line 1: MX record must be in the form "preference exchange"`},
+		{"BadDistance", "@ MX 70000 mail.example.com.", `line 1: "70000" must be a number between 0 and 65535`},
+		{"UnterminatedString", "@ TXT \"abc\n", "line 1: unterminated quoted string"},
+		{"UnbalancedOpen", "@ TXT ( \"abc\"\n", "line 2: unbalanced parentheses"},
+		{"UnbalancedClose", "@ TXT \"abc\" )", "line 1: unbalanced parentheses"},
+		{"BadTTL", "$TTL 1x", `line 1: invalid ttl "1x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input), "example.com")
+			assert.Equal(t, tt.errorMsg, err.Error())
+		})
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected int
+	}{
+		{"0", 0},
+		{"3600", 3600},
+		{"1h", 3600},
+		{"1H30m", 5400},
+		{"1w1d", 691200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ttl, err := parseTTL(tt.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ttl)
+		})
+	}
+
+	for _, input := range []string{"", "h", "1h30", "-1", "abc"} {
+		_, err := parseTTL(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestWriteThenParse(t *testing.T) {
+	records := []namesilo_api.ResourceRecord{
+		{Type: "A", Host: "example.com", Value: "1.2.3.4", TTL: 7207},
+		{Type: "CAA", Host: "example.com", Value: `0 issue "letsencrypt.org"`, TTL: 7207},
+		{Type: "MX", Host: "example.com", Value: "mail.example.com", TTL: 3600, Distance: 10},
+		{Type: "TXT", Host: "example.com", Value: `quote " and \ backslash ` + strings.Repeat("a", 300), TTL: 3600},
+		{Type: "SRV", Host: "_sip._tcp.example.com", Value: "5 5060 sip.example.com", TTL: 7207, Distance: 10},
+		{Type: "CNAME", Host: "www.example.com", Value: "example.com", TTL: 7207},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "example.com", records))
+
+	parsed, err := Parse(&buf, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, records, parsed)
+}
@@ -0,0 +1,134 @@
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+// Longest string a single TXT character-string can hold.
+const maxCharacterStringLength int = 255
+
+// Write renders records as an RFC 1035 master file for zone.
+// Records are sorted so that exporting an unchanged zone always produces the
+// same output.
+func Write(w io.Writer, zone string, records []namesilo_api.ResourceRecord) error {
+	zone, err := namesilo_api.CanonicalHost(zone)
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]namesilo_api.ResourceRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if ah, bh := a.RelativeHost(zone), b.RelativeHost(zone); ah != bh {
+			return ah < bh
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Value < b.Value
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s.\n", zone)
+	fmt.Fprintf(bw, "$TTL %d\n", defaultTTL(sorted))
+
+	for _, rr := range sorted {
+		rdata, err := formatRData(rr)
+		if err != nil {
+			return err
+		}
+
+		owner := rr.RelativeHost(zone)
+		if owner == "" {
+			owner = "@"
+		}
+
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", owner, rr.TTL, rr.Type, rdata)
+	}
+
+	return bw.Flush()
+}
+
+// defaultTTL picks the most common TTL in the zone, preferring the smallest
+// when there's a tie.
+func defaultTTL(records []namesilo_api.ResourceRecord) int {
+	counts := map[int]int{}
+	for _, rr := range records {
+		counts[rr.TTL] += 1
+	}
+
+	ttl, count := namesilo_api.DefaultTTL, 0
+	for t, c := range counts {
+		if c > count || (c == count && t < ttl) {
+			ttl, count = t, c
+		}
+	}
+
+	return ttl
+}
+
+func formatRData(rr namesilo_api.ResourceRecord) (string, error) {
+	switch rr.Type {
+	case namesilo_api.RecordTypeA, namesilo_api.RecordTypeAAAA:
+		return rr.Value, nil
+	case namesilo_api.RecordTypeCNAME, namesilo_api.RecordTypeNS:
+		return absoluteName(rr.Value), nil
+	case namesilo_api.RecordTypeMX:
+		return fmt.Sprintf("%d %s", rr.Distance, absoluteName(rr.Value)), nil
+	case namesilo_api.RecordTypeSRV:
+		fields := strings.Fields(rr.Value)
+		if len(fields) != 3 {
+			return "", fmt.Errorf("cannot export SRV record %s with value %q", rr.Host, rr.Value)
+		}
+		return fmt.Sprintf("%d %s %s %s", rr.Distance, fields[0], fields[1], absoluteName(fields[2])), nil
+	case namesilo_api.RecordTypeTXT:
+		return quoteTXT(rr.Value), nil
+	case namesilo_api.RecordTypeCAA:
+		fields := strings.SplitN(rr.Value, " ", 3)
+		if len(fields) != 3 {
+			return "", fmt.Errorf("cannot export CAA record %s with value %q", rr.Host, rr.Value)
+		}
+		return fmt.Sprintf("%s %s %s", fields[0], fields[1], quoteString(strings.Trim(fields[2], "\""))), nil
+	}
+
+	return "", fmt.Errorf("cannot export record %s with unsupported type %s", rr.Host, rr.Type)
+}
+
+func absoluteName(name string) string {
+	if name == "." || strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// quoteTXT splits a TXT value into as many character-strings as needed to
+// stay within the 255 byte limit of each one.
+func quoteTXT(value string) string {
+	parts := []string{}
+	for len(value) > maxCharacterStringLength {
+		parts = append(parts, quoteString(value[:maxCharacterStringLength]))
+		value = value[maxCharacterStringLength:]
+	}
+	parts = append(parts, quoteString(value))
+
+	return strings.Join(parts, " ")
+}
+
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + s + "\""
+}
@@ -0,0 +1,77 @@
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+import (
+	"github.com/Eagerod/kube-namesilo-dns/pkg/namesilo_api"
+)
+
+func TestWrite(t *testing.T) {
+	records := []namesilo_api.ResourceRecord{
+		{RecordId: "1", Type: "CNAME", Host: "www.example.com", Value: "example.com", TTL: 7207},
+		{RecordId: "2", Type: "A", Host: "example.com", Value: "1.2.3.4", TTL: 7207},
+		{RecordId: "3", Type: "MX", Host: "example.com", Value: "mail2.example.com", TTL: 3600, Distance: 20},
+		{RecordId: "4", Type: "MX", Host: "example.com", Value: "mail1.example.com", TTL: 3600, Distance: 10},
+		{RecordId: "5", Type: "TXT", Host: "example.com", Value: `v=spf1 include:"quoted" \ -all`, TTL: 3600},
+		{RecordId: "6", Type: "SRV", Host: "_sip._tcp.example.com", Value: "5 5060 sip.example.com", TTL: 7207, Distance: 10},
+		{RecordId: "7", Type: "CAA", Host: "example.com", Value: `0 issue "letsencrypt.org"`, TTL: 7207},
+		{RecordId: "8", Type: "AAAA", Host: "xn--caf-dma.example.com", Value: "2001:db8::1", TTL: 7207},
+		{RecordId: "9", Type: "NS", Host: "sub.example.com", Value: "ns1.example.net", TTL: 7207},
+	}
+
+	expected := strings.Join([]string{
+		"$ORIGIN example.com.",
+		"$TTL 7207",
+		"@\t7207\tIN\tA\t1.2.3.4",
+		"@\t7207\tIN\tCAA\t0 issue \"letsencrypt.org\"",
+		"@\t3600\tIN\tMX\t10 mail1.example.com.",
+		"@\t3600\tIN\tMX\t20 mail2.example.com.",
+		"@\t3600\tIN\tTXT\t\"v=spf1 include:\\\"quoted\\\" \\\\ -all\"",
+		"_sip._tcp\t7207\tIN\tSRV\t10 5 5060 sip.example.com.",
+		"sub\t7207\tIN\tNS\tns1.example.net.",
+		"www\t7207\tIN\tCNAME\texample.com.",
+		"xn--caf-dma\t7207\tIN\tAAAA\t2001:db8::1",
+		"",
+	}, "\n")
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "Example.com.", records))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteEmptyZone(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "example.com", nil))
+	assert.Equal(t, "$ORIGIN example.com.\n$TTL 7207\n", buf.String())
+}
+
+func TestWriteLongTXT(t *testing.T) {
+	records := []namesilo_api.ResourceRecord{
+		{Type: "TXT", Host: "example.com", Value: strings.Repeat("a", 300), TTL: 7207},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "example.com", records))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := "@\t7207\tIN\tTXT\t\"" + strings.Repeat("a", 255) + "\" \"" + strings.Repeat("a", 45) + "\""
+	assert.Equal(t, expected, lines[2])
+}
+
+func TestWriteInvalidSRV(t *testing.T) {
+	records := []namesilo_api.ResourceRecord{
+		{Type: "SRV", Host: "_sip._tcp.example.com", Value: "sip.example.com", TTL: 7207},
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, "example.com", records)
+	assert.Equal(t, `cannot export SRV record _sip._tcp.example.com with value "sip.example.com"`, err.Error())
+}